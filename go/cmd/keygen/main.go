@@ -0,0 +1,32 @@
+// cmd/keygen/main.go
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"quantum-chat/internal/encryption"
+)
+
+// keygen creates a hybrid key pair for registering test users. It prints the
+// base64 public key and, with -private, writes the private key to a file.
+func main() {
+    privatePath := flag.String("private", "", "write the base64 private key to this file")
+    flag.Parse()
+
+    sk, err := encryption.GenerateKey()
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    if *privatePath != "" {
+        encoded := base64.StdEncoding.EncodeToString(sk.Bytes()) + "\n"
+        if err := os.WriteFile(*privatePath, []byte(encoded), 0600); err != nil {
+            log.Fatal(err)
+        }
+    }
+    fmt.Println(base64.StdEncoding.EncodeToString(sk.PublicKey().Bytes()))
+}
@@ -3,23 +3,35 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
+	"quantum-chat/internal/blobstore"
 	"quantum-chat/internal/config"
+	"quantum-chat/internal/encryption"
 	"quantum-chat/internal/handlers"
 	"quantum-chat/internal/repository"
+	"quantum-chat/internal/transparency"
 )
 
 type Server struct {
-    config     *config.Config
-    httpServer *http.Server
-    db         *repository.Database
-    handlers   *handlers.Handlers
+    config      *config.Config
+    httpServer  *http.Server
+    db          *repository.Database
+    handlers    *handlers.Handlers
+    stopWorkers chan struct{} // Closed on shutdown to stop background workers
 }
 
 func NewServer(cfg *config.Config) *Server {
@@ -31,6 +43,12 @@ func NewServer(cfg *config.Config) *Server {
 func (s *Server) Initialize() error {
     log.Println("Initializing server...")
 
+    // Refuse to accept keys if the key encapsulation is broken
+    if err := encryption.SelfTest(); err != nil {
+        log.Printf("Encryption self test error: %v", err)
+        return err
+    }
+
     // Initialize database
     log.Println("Connecting to database...")
     db, err := repository.NewDatabase(s.config.DatabaseURL)
@@ -41,9 +59,35 @@ func (s *Server) Initialize() error {
     log.Println("Database connected successfully")
     s.db = db
 
+    if len(s.config.AdminUsers) > 0 {
+        if err := s.db.PromoteAdmins(s.config.AdminUsers); err != nil {
+            log.Printf("Admin promotion error: %v", err)
+            return err
+        }
+    }
+
+    // Initialize attachment storage
+    blobs, err := blobstore.NewLocalStore(s.config.AttachmentDir)
+    if err != nil {
+        log.Printf("Attachment store error: %v", err)
+        return err
+    }
+
+    // Initialize the key transparency log signer
+    logSigner, err := newLogSigner(s.config)
+    if err != nil {
+        log.Printf("Key transparency signer error: %v", err)
+        return err
+    }
+
     // Initialize handlers
     log.Println("Initializing handlers...")
-    s.handlers = handlers.NewHandlers(s.db, s.config)
+    s.handlers = handlers.NewHandlers(s.db, s.config, blobs, logSigner)
+
+    // Start deleting disappearing messages and sending scheduled ones
+    s.stopWorkers = make(chan struct{})
+    go s.handlers.RunReaper(workerInterval(s.config.ReaperInterval, 10*time.Second), s.stopWorkers)
+    go s.handlers.RunScheduler(workerInterval(s.config.SchedulerInterval, 5*time.Second), s.stopWorkers)
 
     // Setup HTTP server
     log.Println("Setting up HTTP server...")
@@ -75,6 +119,10 @@ func (s *Server) Shutdown() {
         log.Printf("Server shutdown error: %v", err)
     }
 
+    if s.stopWorkers != nil {
+        close(s.stopWorkers)
+    }
+
     if s.db != nil {
         if err := s.db.Close(); err != nil {
             log.Printf("Database closure error: %v", err)
@@ -82,6 +130,72 @@ func (s *Server) Shutdown() {
     }
 }
 
+// workerInterval falls back to def for unset intervals
+func workerInterval(d, def time.Duration) time.Duration {
+    if d <= 0 {
+        return def
+    }
+    return d
+}
+
+// newLogSigner loads the tree head signing key. Production servers must
+// configure KT_SIGNING_KEY; development servers without it generate a random
+// key once and keep it in KT_SIGNING_KEY_FILE so it survives restarts.
+func newLogSigner(cfg *config.Config) (*transparency.Signer, error) {
+    if cfg.KTSigningKey != "" {
+        seed, err := base64.StdEncoding.DecodeString(cfg.KTSigningKey)
+        if err != nil {
+            return nil, errors.New("KT_SIGNING_KEY must be base64")
+        }
+        return transparency.NewSigner(seed)
+    }
+    if cfg.Environment == "production" {
+        return nil, errors.New("KT_SIGNING_KEY is required in production")
+    }
+
+    encoded, err := os.ReadFile(cfg.KTSigningKeyFile)
+    if errors.Is(err, fs.ErrNotExist) {
+        log.Printf("Warning: KT_SIGNING_KEY not set, generating a tree head signing key in %s", cfg.KTSigningKeyFile)
+        encoded, err = generateSigningKeyFile(cfg.KTSigningKeyFile)
+    }
+    if err != nil {
+        return nil, err
+    }
+    seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+    if err != nil {
+        return nil, fmt.Errorf("%s must hold a base64 signing key", cfg.KTSigningKeyFile)
+    }
+    return transparency.NewSigner(seed)
+}
+
+// generateSigningKeyFile writes a random base64 signing key seed to path,
+// failing rather than replacing a key that appeared in the meantime
+func generateSigningKeyFile(path string) ([]byte, error) {
+    seed := make([]byte, ed25519.SeedSize)
+    if _, err := rand.Read(seed); err != nil {
+        return nil, err
+    }
+    encoded := []byte(base64.StdEncoding.EncodeToString(seed) + "\n")
+
+    if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+        return nil, err
+    }
+    f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+    if err != nil {
+        return nil, err
+    }
+    if _, err := f.Write(encoded); err != nil {
+        f.Close()
+        os.Remove(path)
+        return nil, err
+    }
+    if err := f.Close(); err != nil {
+        os.Remove(path)
+        return nil, err
+    }
+    return encoded, nil
+}
+
 func main() {
     log.SetFlags(log.LstdFlags | log.Lshortfile)
     
@@ -1,6 +1,6 @@
 module quantum-chat
 
-go 1.21
+go 1.24
 
 require (
 	github.com/golang-jwt/jwt v3.2.2+incompatible
@@ -0,0 +1,40 @@
+// Package blobstore keeps attachment blobs. Blobs are uploaded in chunks to
+// a staging area and, once complete, committed under the hex SHA-256 of
+// their content. The server never sees plaintext: clients encrypt before
+// uploading.
+package blobstore
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+    ErrNotFound       = errors.New("blob not found")
+    ErrOffsetMismatch = errors.New("upload offset does not match received data")
+)
+
+// Store is a pluggable blob backend
+type Store interface {
+    // Append writes a chunk to a staged upload at offset, which must equal
+    // the number of bytes staged so far. It returns the new staged size.
+    Append(uploadID string, offset int64, r io.Reader) (int64, error)
+
+    // Staged returns the number of bytes staged for an upload
+    Staged(uploadID string) (int64, error)
+
+    // Commit stores a staged upload and returns its content address and
+    // size. Committing content that is already stored is not an error. The
+    // staged upload is kept until Abort, so a failed commit can be retried.
+    Commit(uploadID string) (id string, size int64, err error)
+
+    // Abort discards a staged upload
+    Abort(uploadID string) error
+
+    // Open returns a reader for a committed blob and its size
+    Open(id string) (io.ReadCloser, int64, error)
+
+    // Delete removes a committed blob; deleting a missing blob is not an
+    // error
+    Delete(id string) error
+}
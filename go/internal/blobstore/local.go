@@ -0,0 +1,217 @@
+package blobstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+var (
+    uploadIDPattern = regexp.MustCompile(`^[a-f0-9]{32}$`)
+    blobIDPattern   = regexp.MustCompile(`^[a-f0-9]{64}$`)
+)
+
+// LocalStore keeps blobs on the local filesystem:
+//
+//     <root>/uploads/<upload id>       staged uploads
+//     <root>/blobs/<ab>/<ab...>        committed blobs, by SHA-256
+type LocalStore struct {
+    root string
+
+    // Appends, commits and aborts of one upload take turns
+    mutex   sync.Mutex
+    uploads map[string]*uploadLock
+}
+
+type uploadLock struct {
+    sync.Mutex
+    refs int
+}
+
+func NewLocalStore(root string) (*LocalStore, error) {
+    for _, dir := range []string{"uploads", "blobs"} {
+        if err := os.MkdirAll(filepath.Join(root, dir), 0o700); err != nil {
+            return nil, fmt.Errorf("failed to create blob directory: %v", err)
+        }
+    }
+    return &LocalStore{root: root, uploads: make(map[string]*uploadLock)}, nil
+}
+
+// lockUpload locks one upload and returns the function that unlocks it
+func (s *LocalStore) lockUpload(uploadID string) func() {
+    s.mutex.Lock()
+    lock, ok := s.uploads[uploadID]
+    if !ok {
+        lock = &uploadLock{}
+        s.uploads[uploadID] = lock
+    }
+    lock.refs++
+    s.mutex.Unlock()
+
+    lock.Lock()
+    return func() {
+        lock.Unlock()
+        s.mutex.Lock()
+        lock.refs--
+        if lock.refs == 0 {
+            delete(s.uploads, uploadID)
+        }
+        s.mutex.Unlock()
+    }
+}
+
+func (s *LocalStore) Append(uploadID string, offset int64, r io.Reader) (int64, error) {
+    path, err := s.uploadPath(uploadID)
+    if err != nil {
+        return 0, err
+    }
+    defer s.lockUpload(uploadID)()
+
+    f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0o600)
+    if err != nil {
+        return 0, err
+    }
+    defer f.Close()
+
+    info, err := f.Stat()
+    if err != nil {
+        return 0, err
+    }
+    if info.Size() != offset {
+        return info.Size(), ErrOffsetMismatch
+    }
+
+    if _, err := f.Seek(offset, io.SeekStart); err != nil {
+        return 0, err
+    }
+    n, err := io.Copy(f, r)
+    if err != nil {
+        // Drop a partially written chunk so the client can resend it
+        f.Truncate(offset)
+        return offset, err
+    }
+    return offset + n, f.Sync()
+}
+
+func (s *LocalStore) Staged(uploadID string) (int64, error) {
+    path, err := s.uploadPath(uploadID)
+    if err != nil {
+        return 0, err
+    }
+    info, err := os.Stat(path)
+    if os.IsNotExist(err) {
+        return 0, nil
+    }
+    if err != nil {
+        return 0, err
+    }
+    return info.Size(), nil
+}
+
+// Commit copies the staged upload into the blob store while hashing it. The
+// staged copy stays until Abort, so a commit whose bookkeeping failed can be
+// retried.
+func (s *LocalStore) Commit(uploadID string) (string, int64, error) {
+    path, err := s.uploadPath(uploadID)
+    if err != nil {
+        return "", 0, err
+    }
+    defer s.lockUpload(uploadID)()
+
+    f, err := os.Open(path)
+    if os.IsNotExist(err) {
+        return "", 0, ErrNotFound
+    }
+    if err != nil {
+        return "", 0, err
+    }
+    defer f.Close()
+
+    tmp, err := os.CreateTemp(filepath.Join(s.root, "blobs"), "commit-*")
+    if err != nil {
+        return "", 0, err
+    }
+    defer os.Remove(tmp.Name())
+    defer tmp.Close()
+
+    hash := sha256.New()
+    size, err := io.Copy(io.MultiWriter(hash, tmp), f)
+    if err != nil {
+        return "", 0, err
+    }
+    if err := tmp.Sync(); err != nil {
+        return "", 0, err
+    }
+    id := hex.EncodeToString(hash.Sum(nil))
+
+    blobPath := s.blobPath(id)
+    if _, err := os.Stat(blobPath); err == nil {
+        // Same content was stored before
+        return id, size, nil
+    }
+    if err := os.MkdirAll(filepath.Dir(blobPath), 0o700); err != nil {
+        return "", 0, err
+    }
+    if err := os.Rename(tmp.Name(), blobPath); err != nil {
+        return "", 0, err
+    }
+    return id, size, nil
+}
+
+func (s *LocalStore) Abort(uploadID string) error {
+    path, err := s.uploadPath(uploadID)
+    if err != nil {
+        return err
+    }
+    defer s.lockUpload(uploadID)()
+    if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+        return err
+    }
+    return nil
+}
+
+func (s *LocalStore) Delete(id string) error {
+    if !blobIDPattern.MatchString(id) {
+        return nil
+    }
+    if err := os.Remove(s.blobPath(id)); err != nil && !os.IsNotExist(err) {
+        return err
+    }
+    return nil
+}
+
+func (s *LocalStore) Open(id string) (io.ReadCloser, int64, error) {
+    if !blobIDPattern.MatchString(id) {
+        return nil, 0, ErrNotFound
+    }
+    f, err := os.Open(s.blobPath(id))
+    if os.IsNotExist(err) {
+        return nil, 0, ErrNotFound
+    }
+    if err != nil {
+        return nil, 0, err
+    }
+    info, err := f.Stat()
+    if err != nil {
+        f.Close()
+        return nil, 0, err
+    }
+    return f, info.Size(), nil
+}
+
+// uploadPath validates the upload ID so it cannot escape the upload directory
+func (s *LocalStore) uploadPath(uploadID string) (string, error) {
+    if !uploadIDPattern.MatchString(uploadID) {
+        return "", ErrNotFound
+    }
+    return filepath.Join(s.root, "uploads", uploadID), nil
+}
+
+func (s *LocalStore) blobPath(id string) string {
+    return filepath.Join(s.root, "blobs", id[:2], id)
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -19,6 +21,14 @@ type Config struct {
     RedisURL    string
     JWTSecret   string
     Environment string
+    EditWindow  time.Duration // How long after sending a message may be edited; 0 disables the limit
+
+    ReaperInterval    time.Duration // How often expired messages are deleted
+    SchedulerInterval time.Duration // How often due scheduled messages are sent
+    AttachmentDir     string        // Root of the local attachment blob store
+    AdminUsers        []string      // Existing users promoted to admin at startup
+    KTSigningKey      string        // Base64 Ed25519 seed for signing key transparency tree heads
+    KTSigningKeyFile  string        // Where development servers keep a generated signing key
 }
 
 func LoadConfig() *Config {
@@ -46,6 +56,14 @@ func LoadConfig() *Config {
             getEnvOrDefault("REDIS_PORT", "6379")),
         JWTSecret:   getEnvOrDefault("JWT_SECRET", "your_development_secret_key_123"),
         Environment: getEnvOrDefault("ENV", "development"),
+        EditWindow:  getDurationOrDefault("MESSAGE_EDIT_WINDOW", 15*time.Minute),
+
+        ReaperInterval:    getDurationOrDefault("MESSAGE_REAPER_INTERVAL", 10*time.Second),
+        SchedulerInterval: getDurationOrDefault("SCHEDULER_INTERVAL", 5*time.Second),
+        AttachmentDir:     getEnvOrDefault("ATTACHMENT_DIR", "data/attachments"),
+        AdminUsers:        getListOrDefault("ADMIN_USERS", nil),
+        KTSigningKey:      os.Getenv("KT_SIGNING_KEY"),
+        KTSigningKeyFile:  getEnvOrDefault("KT_SIGNING_KEY_FILE", "data/kt_signing_key"),
     }
 }
 
@@ -54,4 +72,32 @@ func getEnvOrDefault(key, defaultValue string) string {
         return value
     }
     return defaultValue
+}
+
+func getDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+    value := os.Getenv(key)
+    if value == "" {
+        return defaultValue
+    }
+    d, err := time.ParseDuration(value)
+    if err != nil || d < 0 {
+        log.Printf("Warning: invalid duration for %s: %q, using %s", key, value, defaultValue)
+        return defaultValue
+    }
+    return d
+}
+
+// getListOrDefault reads a comma-separated list
+func getListOrDefault(key string, defaultValue []string) []string {
+    value := os.Getenv(key)
+    if value == "" {
+        return defaultValue
+    }
+    var list []string
+    for _, item := range strings.Split(value, ",") {
+        if item = strings.TrimSpace(item); item != "" {
+            list = append(list, item)
+        }
+    }
+    return list
 }
\ No newline at end of file
@@ -0,0 +1,233 @@
+// Package encryption implements the hybrid post-quantum key encapsulation
+// used for end-to-end encryption. Keys combine X25519 and ML-KEM-768 the way
+// X-Wing does, so the shared key stays secret as long as either of the two
+// holds up.
+//
+// Every encoded key and ciphertext starts with a version byte naming the
+// scheme, so clients and the server can tell formats apart once a second
+// scheme exists.
+package encryption
+
+import (
+	"crypto/ecdh"
+	"crypto/mlkem"
+	"crypto/rand"
+	"crypto/sha3"
+	"crypto/subtle"
+	"errors"
+)
+
+// Version bytes. Each kind of key gets its own value so an encoding can
+// never be mistaken for another kind.
+const (
+    // VersionXWing marks X25519 + ML-KEM-768 keys and ciphertexts
+    VersionXWing byte = 1
+
+    // VersionX25519 marks classical X25519 public keys
+    VersionX25519 byte = 2
+
+    // VersionEd25519 marks Ed25519 identity keys
+    VersionEd25519 byte = 3
+)
+
+const (
+    x25519Size = 32
+
+    // SeedSize is the size of the secret a private key is derived from
+    SeedSize = 32
+
+    // SharedKeySize is the size of the key both sides end up with
+    SharedKeySize = 32
+
+    // Encoded sizes, including the version byte
+    PublicKeySize  = 1 + mlkem.EncapsulationKeySize768 + x25519Size
+    PrivateKeySize = 1 + SeedSize
+    CiphertextSize = 1 + mlkem.CiphertextSize768 + x25519Size
+)
+
+// xwingLabel separates the combiner from other uses of SHA3-256
+var xwingLabel = []byte(`\.//^\`)
+
+var (
+    ErrUnsupportedVersion = errors.New("unsupported key or ciphertext version")
+    ErrInvalidPublicKey   = errors.New("invalid public key")
+    ErrInvalidPrivateKey  = errors.New("invalid private key")
+    ErrInvalidCiphertext  = errors.New("invalid ciphertext")
+)
+
+// PublicKey is the encapsulation half of a hybrid key pair
+type PublicKey struct {
+    mlkem  *mlkem.EncapsulationKey768
+    x25519 *ecdh.PublicKey
+}
+
+// PrivateKey is a hybrid key pair. Only its seed is ever encoded; both
+// component keys are derived from it.
+type PrivateKey struct {
+    seed   [SeedSize]byte
+    mlkem  *mlkem.DecapsulationKey768
+    x25519 *ecdh.PrivateKey
+    public *PublicKey
+}
+
+// GenerateKey creates a key pair from a random seed
+func GenerateKey() (*PrivateKey, error) {
+    seed := make([]byte, SeedSize)
+    if _, err := rand.Read(seed); err != nil {
+        return nil, err
+    }
+    return NewPrivateKey(seed)
+}
+
+// NewPrivateKey derives a key pair from a seed. The seed is expanded with
+// SHAKE256 into the ML-KEM-768 seed followed by the X25519 scalar.
+func NewPrivateKey(seed []byte) (*PrivateKey, error) {
+    if len(seed) != SeedSize {
+        return nil, ErrInvalidPrivateKey
+    }
+
+    expanded := sha3.SumSHAKE256(seed, mlkem.SeedSize+x25519Size)
+    dk, err := mlkem.NewDecapsulationKey768(expanded[:mlkem.SeedSize])
+    if err != nil {
+        return nil, err
+    }
+    xk, err := ecdh.X25519().NewPrivateKey(expanded[mlkem.SeedSize:])
+    if err != nil {
+        return nil, err
+    }
+
+    sk := &PrivateKey{
+        mlkem:  dk,
+        x25519: xk,
+        public: &PublicKey{mlkem: dk.EncapsulationKey(), x25519: xk.PublicKey()},
+    }
+    copy(sk.seed[:], seed)
+    return sk, nil
+}
+
+// ParsePrivateKey decodes a private key produced by PrivateKey.Bytes
+func ParsePrivateKey(b []byte) (*PrivateKey, error) {
+    if err := checkVersion(b, VersionXWing); err != nil {
+        return nil, err
+    }
+    if len(b) != PrivateKeySize {
+        return nil, ErrInvalidPrivateKey
+    }
+    return NewPrivateKey(b[1:])
+}
+
+// Bytes encodes the private key as the version byte followed by the seed
+func (sk *PrivateKey) Bytes() []byte {
+    return append([]byte{VersionXWing}, sk.seed[:]...)
+}
+
+// PublicKey returns the public half of the key pair
+func (sk *PrivateKey) PublicKey() *PublicKey {
+    return sk.public
+}
+
+// ParsePublicKey decodes a public key produced by PublicKey.Bytes
+func ParsePublicKey(b []byte) (*PublicKey, error) {
+    if err := checkVersion(b, VersionXWing); err != nil {
+        return nil, err
+    }
+    if len(b) != PublicKeySize {
+        return nil, ErrInvalidPublicKey
+    }
+
+    body := b[1:]
+    ek, err := mlkem.NewEncapsulationKey768(body[:mlkem.EncapsulationKeySize768])
+    if err != nil {
+        return nil, ErrInvalidPublicKey
+    }
+    xk, err := ecdh.X25519().NewPublicKey(body[mlkem.EncapsulationKeySize768:])
+    if err != nil {
+        return nil, ErrInvalidPublicKey
+    }
+    return &PublicKey{mlkem: ek, x25519: xk}, nil
+}
+
+// Bytes encodes the public key as the version byte followed by the
+// ML-KEM-768 encapsulation key and the X25519 public key
+func (pk *PublicKey) Bytes() []byte {
+    b := make([]byte, 0, PublicKeySize)
+    b = append(b, VersionXWing)
+    b = append(b, pk.mlkem.Bytes()...)
+    return append(b, pk.x25519.Bytes()...)
+}
+
+// Equal reports whether two public keys are the same
+func (pk *PublicKey) Equal(other *PublicKey) bool {
+    return subtle.ConstantTimeCompare(pk.Bytes(), other.Bytes()) == 1
+}
+
+// Encapsulate creates a fresh shared key for the owner of pk and the
+// ciphertext that lets them recover it
+func (pk *PublicKey) Encapsulate() (sharedKey, ciphertext []byte, err error) {
+    ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+    if err != nil {
+        return nil, nil, err
+    }
+    ssX, err := ephemeral.ECDH(pk.x25519)
+    if err != nil {
+        return nil, nil, err
+    }
+    ssM, ctM := pk.mlkem.Encapsulate()
+    ctX := ephemeral.PublicKey().Bytes()
+
+    ciphertext = make([]byte, 0, CiphertextSize)
+    ciphertext = append(ciphertext, VersionXWing)
+    ciphertext = append(ciphertext, ctM...)
+    ciphertext = append(ciphertext, ctX...)
+    return combine(ssM, ssX, ctX, pk.x25519.Bytes()), ciphertext, nil
+}
+
+// Decapsulate recovers the shared key from a ciphertext made for sk. A
+// tampered ML-KEM ciphertext does not fail but yields an unrelated key.
+func (sk *PrivateKey) Decapsulate(ciphertext []byte) ([]byte, error) {
+    if err := checkVersion(ciphertext, VersionXWing); err != nil {
+        return nil, err
+    }
+    if len(ciphertext) != CiphertextSize {
+        return nil, ErrInvalidCiphertext
+    }
+
+    body := ciphertext[1:]
+    ssM, err := sk.mlkem.Decapsulate(body[:mlkem.CiphertextSize768])
+    if err != nil {
+        return nil, ErrInvalidCiphertext
+    }
+    ctX := body[mlkem.CiphertextSize768:]
+    ephemeral, err := ecdh.X25519().NewPublicKey(ctX)
+    if err != nil {
+        return nil, ErrInvalidCiphertext
+    }
+    ssX, err := sk.x25519.ECDH(ephemeral)
+    if err != nil {
+        return nil, ErrInvalidCiphertext
+    }
+    return combine(ssM, ssX, ctX, sk.public.x25519.Bytes()), nil
+}
+
+// combine is the X-Wing combiner. Binding the X25519 ciphertext and public
+// key keeps the classical half secure on its own; ML-KEM already binds its
+// ciphertext.
+func combine(ssM, ssX, ctX, pkX []byte) []byte {
+    h := sha3.New256()
+    h.Write(ssM)
+    h.Write(ssX)
+    h.Write(ctX)
+    h.Write(pkX)
+    h.Write(xwingLabel)
+    return h.Sum(nil)
+}
+
+func checkVersion(b []byte, version byte) error {
+    if len(b) == 0 {
+        return ErrUnsupportedVersion
+    }
+    if b[0] != version {
+        return ErrUnsupportedVersion
+    }
+    return nil
+}
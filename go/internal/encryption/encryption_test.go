@@ -0,0 +1,183 @@
+package encryption
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestKnownAnswers(t *testing.T) {
+    for i, kat := range knownAnswers {
+        t.Run(fmt.Sprint(i), func(t *testing.T) {
+            if err := kat.check(); err != nil {
+                t.Fatal(err)
+            }
+        })
+    }
+}
+
+// TestKnownAnswerDetectsChanges makes sure a wrong vector fails, so a
+// broken check cannot pass the table silently
+func TestKnownAnswerDetectsChanges(t *testing.T) {
+    kat := knownAnswers[0]
+    kat.sharedKey = knownAnswers[1].sharedKey
+    if err := kat.check(); err == nil {
+        t.Fatal("check passed with the wrong shared key")
+    }
+
+    kat = knownAnswers[0]
+    kat.publicKeyHash = knownAnswers[1].publicKeyHash
+    if err := kat.check(); err == nil {
+        t.Fatal("check passed with the wrong public key")
+    }
+}
+
+// withVersion returns a copy of b with its version byte replaced
+func withVersion(b []byte, version byte) []byte {
+    c := bytes.Clone(b)
+    c[0] = version
+    return c
+}
+
+func TestParseErrors(t *testing.T) {
+    sk, err := NewPrivateKey(mustHex(knownAnswers[0].seed))
+    if err != nil {
+        t.Fatal(err)
+    }
+    privateKey := sk.Bytes()
+    publicKey := sk.PublicKey().Bytes()
+    ciphertext := mustHex(knownAnswers[0].ciphertext)
+
+    parsers := []struct {
+        name    string
+        valid   []byte
+        invalid error
+        parse   func([]byte) error
+    }{
+        {"private key", privateKey, ErrInvalidPrivateKey, func(b []byte) error {
+            _, err := ParsePrivateKey(b)
+            return err
+        }},
+        {"public key", publicKey, ErrInvalidPublicKey, func(b []byte) error {
+            _, err := ParsePublicKey(b)
+            return err
+        }},
+        {"ciphertext", ciphertext, ErrInvalidCiphertext, func(b []byte) error {
+            _, err := sk.Decapsulate(b)
+            return err
+        }},
+    }
+
+    for _, p := range parsers {
+        t.Run(p.name, func(t *testing.T) {
+            if err := p.parse(p.valid); err != nil {
+                t.Fatalf("valid encoding: %v", err)
+            }
+
+            tests := []struct {
+                name  string
+                input []byte
+                want  error
+            }{
+                {"empty", nil, ErrUnsupportedVersion},
+                {"version 0", withVersion(p.valid, 0), ErrUnsupportedVersion},
+                {"x25519 version", withVersion(p.valid, VersionX25519), ErrUnsupportedVersion},
+                {"ed25519 version", withVersion(p.valid, VersionEd25519), ErrUnsupportedVersion},
+                {"unknown version", withVersion(p.valid, 0xff), ErrUnsupportedVersion},
+                {"version byte only", p.valid[:1], p.invalid},
+                {"one byte short", p.valid[:len(p.valid)-1], p.invalid},
+                {"one byte long", append(bytes.Clone(p.valid), 0), p.invalid},
+                {"doubled", append(bytes.Clone(p.valid), p.valid[1:]...), p.invalid},
+            }
+            for _, tt := range tests {
+                if err := p.parse(tt.input); !errors.Is(err, tt.want) {
+                    t.Errorf("%s: error = %v, want %v", tt.name, err, tt.want)
+                }
+            }
+        })
+    }
+}
+
+func TestNewPrivateKeySeedLength(t *testing.T) {
+    for _, n := range []int{0, SeedSize - 1, SeedSize + 1} {
+        if _, err := NewPrivateKey(make([]byte, n)); !errors.Is(err, ErrInvalidPrivateKey) {
+            t.Errorf("seed of %d bytes: error = %v, want %v", n, err, ErrInvalidPrivateKey)
+        }
+    }
+}
+
+func TestEncapsulateRoundTrip(t *testing.T) {
+    sk, err := GenerateKey()
+    if err != nil {
+        t.Fatal(err)
+    }
+    other, err := GenerateKey()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // The peer only ever sees the encoded public key
+    pk, err := ParsePublicKey(sk.PublicKey().Bytes())
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    sharedKey, ciphertext, err := pk.Encapsulate()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(sharedKey) != SharedKeySize || len(ciphertext) != CiphertextSize {
+        t.Fatalf("shared key %d bytes, ciphertext %d bytes; want %d and %d",
+            len(sharedKey), len(ciphertext), SharedKeySize, CiphertextSize)
+    }
+
+    recovered, err := sk.Decapsulate(ciphertext)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !bytes.Equal(sharedKey, recovered) {
+        t.Fatal("decapsulated key differs from the encapsulated one")
+    }
+
+    // A parsed copy of the private key decapsulates the same
+    parsed, err := ParsePrivateKey(sk.Bytes())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if recovered, err := parsed.Decapsulate(ciphertext); err != nil || !bytes.Equal(sharedKey, recovered) {
+        t.Fatalf("parsed private key: %v", err)
+    }
+
+    // Encapsulation is randomized
+    again, ciphertext2, err := pk.Encapsulate()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if bytes.Equal(sharedKey, again) || bytes.Equal(ciphertext, ciphertext2) {
+        t.Fatal("two encapsulations produced the same output")
+    }
+
+    // Another key and a tampered ML-KEM ciphertext yield unrelated keys
+    if wrong, err := other.Decapsulate(ciphertext); err != nil || bytes.Equal(sharedKey, wrong) {
+        t.Fatalf("other key recovered the shared key: %v", err)
+    }
+    tampered := bytes.Clone(ciphertext)
+    tampered[1] ^= 1
+    if wrong, err := sk.Decapsulate(tampered); err != nil || bytes.Equal(sharedKey, wrong) {
+        t.Fatalf("tampered ciphertext recovered the shared key: %v", err)
+    }
+
+    // A low-order X25519 point is refused
+    zeroed := bytes.Clone(ciphertext)
+    clear(zeroed[CiphertextSize-x25519Size:])
+    if _, err := sk.Decapsulate(zeroed); !errors.Is(err, ErrInvalidCiphertext) {
+        t.Fatalf("zero X25519 ciphertext: error = %v, want %v", err, ErrInvalidCiphertext)
+    }
+}
+
+func TestSelfTest(t *testing.T) {
+    if err := SelfTest(); err != nil {
+        t.Fatal(err)
+    }
+}
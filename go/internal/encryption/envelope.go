@@ -0,0 +1,104 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// EnvelopeVersion is the only envelope format so far
+const EnvelopeVersion = 1
+
+// Symmetric suites a message may be sealed with. The key comes from the
+// session the key ID names; the server never sees it.
+const (
+    SuiteAES256GCM         = "aes-256-gcm"
+    SuiteChaCha20Poly1305  = "chacha20-poly1305"
+    SuiteXChaCha20Poly1305 = "xchacha20-poly1305"
+)
+
+const (
+    // maxKeyIDLength bounds the key ID a client may attach
+    maxKeyIDLength = 128
+
+    // Plaintexts are padded to a power of two between these sizes, so the
+    // ciphertext only tells roughly how long a message is
+    minPadBucket = 256
+    maxPadBucket = 256 * 1024
+)
+
+type suite struct {
+    nonceSize int
+    tagSize   int
+}
+
+var suites = map[string]suite{
+    SuiteAES256GCM:         {nonceSize: 12, tagSize: 16},
+    SuiteChaCha20Poly1305:  {nonceSize: 12, tagSize: 16},
+    SuiteXChaCha20Poly1305: {nonceSize: 24, tagSize: 16},
+}
+
+var (
+    ErrMalformedEnvelope          = errors.New("malformed envelope")
+    ErrUnsupportedEnvelopeVersion = errors.New("unsupported envelope version")
+    ErrUnsupportedSuite           = errors.New("unsupported envelope algorithm")
+    ErrInvalidKeyID               = errors.New("invalid envelope key ID")
+    ErrInvalidNonce               = errors.New("invalid envelope nonce")
+    ErrInvalidPadding             = errors.New("invalid envelope padding bucket")
+)
+
+// Envelope is the content of an end-to-end encrypted message. The server
+// checks its shape and stores it as it is.
+type Envelope struct {
+    V     int    `json:"v"`
+    Alg   string `json:"alg"`
+    KID   string `json:"kid"`
+    Nonce []byte `json:"nonce"`
+    CT    []byte `json:"ct"`
+    Pad   int    `json:"pad"` // Padded plaintext size; ct is this plus the tag
+}
+
+// ParseEnvelope decodes an envelope and checks it against its suite.
+// Unknown fields are refused so nothing unencrypted rides along.
+func ParseEnvelope(data []byte) (*Envelope, error) {
+    dec := json.NewDecoder(bytes.NewReader(data))
+    dec.DisallowUnknownFields()
+
+    var env Envelope
+    if err := dec.Decode(&env); err != nil {
+        return nil, ErrMalformedEnvelope
+    }
+    if _, err := dec.Token(); err != io.EOF {
+        return nil, ErrMalformedEnvelope
+    }
+    if err := env.Validate(); err != nil {
+        return nil, err
+    }
+    return &env, nil
+}
+
+// Validate checks the version, suite, key ID, nonce and padding
+func (e *Envelope) Validate() error {
+    if e.V != EnvelopeVersion {
+        return ErrUnsupportedEnvelopeVersion
+    }
+    s, ok := suites[e.Alg]
+    if !ok {
+        return ErrUnsupportedSuite
+    }
+    if len(e.KID) == 0 || len(e.KID) > maxKeyIDLength {
+        return ErrInvalidKeyID
+    }
+    if len(e.Nonce) != s.nonceSize {
+        return ErrInvalidNonce
+    }
+    if !validPadBucket(e.Pad) || len(e.CT) != e.Pad+s.tagSize {
+        return ErrInvalidPadding
+    }
+    return nil
+}
+
+func validPadBucket(pad int) bool {
+    return pad >= minPadBucket && pad <= maxPadBucket && pad&(pad-1) == 0
+}
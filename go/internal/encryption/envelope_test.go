@@ -0,0 +1,127 @@
+package encryption
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testEnvelope returns the fields of a valid envelope for the suite, to be
+// changed by each test case
+func testEnvelope(alg string) map[string]interface{} {
+    s := suites[alg]
+    return map[string]interface{}{
+        "v":     EnvelopeVersion,
+        "alg":   alg,
+        "kid":   "session-1",
+        "nonce": make([]byte, s.nonceSize),
+        "ct":    make([]byte, minPadBucket+s.tagSize),
+        "pad":   minPadBucket,
+    }
+}
+
+func encodeEnvelope(t *testing.T, fields map[string]interface{}) []byte {
+    t.Helper()
+    data, err := json.Marshal(fields)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return data
+}
+
+func TestParseEnvelope(t *testing.T) {
+    for alg, s := range suites {
+        t.Run(alg, func(t *testing.T) {
+            tests := []struct {
+                name   string
+                modify func(e map[string]interface{})
+                want   error
+            }{
+                {"valid", func(e map[string]interface{}) {}, nil},
+                {"largest bucket", func(e map[string]interface{}) {
+                    e["pad"] = maxPadBucket
+                    e["ct"] = make([]byte, maxPadBucket+s.tagSize)
+                }, nil},
+                {"longest key ID", func(e map[string]interface{}) { e["kid"] = strings.Repeat("k", maxKeyIDLength) }, nil},
+
+                {"version 0", func(e map[string]interface{}) { e["v"] = 0 }, ErrUnsupportedEnvelopeVersion},
+                {"version 2", func(e map[string]interface{}) { e["v"] = 2 }, ErrUnsupportedEnvelopeVersion},
+                {"no version", func(e map[string]interface{}) { delete(e, "v") }, ErrUnsupportedEnvelopeVersion},
+                {"unknown alg", func(e map[string]interface{}) { e["alg"] = "aes-128-cbc" }, ErrUnsupportedSuite},
+                {"alg case", func(e map[string]interface{}) { e["alg"] = strings.ToUpper(alg) }, ErrUnsupportedSuite},
+                {"empty key ID", func(e map[string]interface{}) { e["kid"] = "" }, ErrInvalidKeyID},
+                {"long key ID", func(e map[string]interface{}) { e["kid"] = strings.Repeat("k", maxKeyIDLength+1) }, ErrInvalidKeyID},
+                {"short nonce", func(e map[string]interface{}) { e["nonce"] = make([]byte, s.nonceSize-1) }, ErrInvalidNonce},
+                {"long nonce", func(e map[string]interface{}) { e["nonce"] = make([]byte, s.nonceSize+1) }, ErrInvalidNonce},
+                {"no nonce", func(e map[string]interface{}) { delete(e, "nonce") }, ErrInvalidNonce},
+                {"pad not a power of two", func(e map[string]interface{}) {
+                    e["pad"] = 384
+                    e["ct"] = make([]byte, 384+s.tagSize)
+                }, ErrInvalidPadding},
+                {"pad below smallest bucket", func(e map[string]interface{}) {
+                    e["pad"] = minPadBucket / 2
+                    e["ct"] = make([]byte, minPadBucket/2+s.tagSize)
+                }, ErrInvalidPadding},
+                {"pad above largest bucket", func(e map[string]interface{}) {
+                    e["pad"] = maxPadBucket * 2
+                    e["ct"] = make([]byte, maxPadBucket*2+s.tagSize)
+                }, ErrInvalidPadding},
+                {"zero pad", func(e map[string]interface{}) {
+                    e["pad"] = 0
+                    e["ct"] = make([]byte, s.tagSize)
+                }, ErrInvalidPadding},
+                {"negative pad", func(e map[string]interface{}) { e["pad"] = -minPadBucket }, ErrInvalidPadding},
+                {"ciphertext without tag", func(e map[string]interface{}) { e["ct"] = make([]byte, minPadBucket) }, ErrInvalidPadding},
+                {"ciphertext one byte short", func(e map[string]interface{}) { e["ct"] = make([]byte, minPadBucket+s.tagSize-1) }, ErrInvalidPadding},
+                {"ciphertext one byte long", func(e map[string]interface{}) { e["ct"] = make([]byte, minPadBucket+s.tagSize+1) }, ErrInvalidPadding},
+                {"unknown field", func(e map[string]interface{}) { e["text"] = "hi" }, ErrMalformedEnvelope},
+                {"wrong field type", func(e map[string]interface{}) { e["v"] = "1" }, ErrMalformedEnvelope},
+                {"nonce not base64", func(e map[string]interface{}) { e["nonce"] = "not base64!" }, ErrMalformedEnvelope},
+            }
+            for _, tt := range tests {
+                fields := testEnvelope(alg)
+                tt.modify(fields)
+                env, err := ParseEnvelope(encodeEnvelope(t, fields))
+                if !errors.Is(err, tt.want) {
+                    t.Errorf("%s: error = %v, want %v", tt.name, err, tt.want)
+                }
+                if tt.want == nil && (env == nil || env.Alg != alg) {
+                    t.Errorf("%s: envelope = %+v", tt.name, env)
+                }
+            }
+        })
+    }
+}
+
+func TestParseEnvelopeMalformed(t *testing.T) {
+    valid := string(encodeEnvelope(t, testEnvelope(SuiteAES256GCM)))
+
+    tests := []struct {
+        name    string
+        content string
+    }{
+        {"empty", ""},
+        {"null", "null"},
+        {"plain string", `"hi"`},
+        {"number", "1"},
+        {"array", "[" + valid + "]"},
+        {"plaintext object", `{"text":"hi"}`},
+        {"trailing object", valid + valid},
+        {"trailing value", valid + " 1"},
+        {"trailing garbage", valid + "x"},
+        {"truncated", valid[:len(valid)-1]},
+    }
+    for _, tt := range tests {
+        env, err := ParseEnvelope([]byte(tt.content))
+        if err == nil {
+            t.Errorf("%s: parsed %+v", tt.name, env)
+        }
+    }
+
+    // Whitespace around the object is fine
+    if _, err := ParseEnvelope([]byte(fmt.Sprintf("\n %s \n", valid))); err != nil {
+        t.Errorf("surrounding whitespace: %v", err)
+    }
+}
@@ -0,0 +1,67 @@
+package encryption
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"errors"
+)
+
+const (
+    // IdentityKeySize is the encoded size of an identity key
+    IdentityKeySize = 1 + ed25519.PublicKeySize
+
+    // ClassicalKeySize is the encoded size of an X25519 public key
+    ClassicalKeySize = 1 + x25519Size
+)
+
+var (
+    ErrInvalidIdentityKey = errors.New("invalid identity key")
+    ErrInvalidSignature   = errors.New("invalid signature")
+)
+
+// IdentityKey is the long-term Ed25519 key of a device. It signs the
+// device's prekeys so peers can tell they were not swapped by the server.
+type IdentityKey struct {
+    key ed25519.PublicKey
+}
+
+// ParseIdentityKey decodes an identity key: the version byte followed by
+// the Ed25519 public key
+func ParseIdentityKey(b []byte) (*IdentityKey, error) {
+    if err := checkVersion(b, VersionEd25519); err != nil {
+        return nil, err
+    }
+    if len(b) != IdentityKeySize {
+        return nil, ErrInvalidIdentityKey
+    }
+    return &IdentityKey{key: ed25519.PublicKey(append([]byte(nil), b[1:]...))}, nil
+}
+
+// Bytes encodes the identity key
+func (k *IdentityKey) Bytes() []byte {
+    return append([]byte{VersionEd25519}, k.key...)
+}
+
+// Verify checks a signature over an encoded key
+func (k *IdentityKey) Verify(encodedKey, signature []byte) error {
+    if !ed25519.Verify(k.key, encodedKey, signature) {
+        return ErrInvalidSignature
+    }
+    return nil
+}
+
+// ParseClassicalKey decodes an X25519 public key: the version byte followed
+// by the 32-byte key
+func ParseClassicalKey(b []byte) (*ecdh.PublicKey, error) {
+    if err := checkVersion(b, VersionX25519); err != nil {
+        return nil, err
+    }
+    if len(b) != ClassicalKeySize {
+        return nil, ErrInvalidPublicKey
+    }
+    key, err := ecdh.X25519().NewPublicKey(b[1:])
+    if err != nil {
+        return nil, ErrInvalidPublicKey
+    }
+    return key, nil
+}
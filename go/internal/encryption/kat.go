@@ -0,0 +1,174 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/sha3"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// knownAnswer pins the key derivation, the encodings and the combiner. The
+// public key is given as its SHA3-256 to keep the table readable.
+type knownAnswer struct {
+    seed          string
+    publicKeyHash string
+    ciphertext    string
+    sharedKey     string
+}
+
+var knownAnswers = []knownAnswer{
+    {
+        seed:          "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+        publicKeyHash: "c7afe083d0a6b5d1993eda64e80674f6066272da22e9b6f969a51642e89666c9",
+        ciphertext:    `
+            017187a1d58949736791be5d36e3c489b4aabc77ac423fcdac21fe3ca947fefd
+            c7fc3abb33b4d7486180903e69d7ee8a780153ad0807b25e2800b6c7d197c0e9
+            c76f227505ddb0b0e5827449928a972c04be4c9f3676bd706214ea84de337e43
+            4dc91b928d82a54a9f86e8352f4bcfb9448bb30371b8d1a4edc15ecd23d84695
+            b9b5522c5be3b3dc81090cce29cd7b8d630b6d8e2a9c9acb81734773d0014aa1
+            20bf07c139d5aa4bca2491dc599c886dfc1786081ed6c65ed819f1957f938c2c
+            c4b4edb597d6dc8705a37dfe2021448128fedaadc4cd3fcf9c55f840e83a062c
+            eb995fd377fa3853bdc1b8dc99d633a16239495654742231432da7176ba09aea
+            8743271180cf5fefaceb504c4c4d27698e128f16514aa41fc3008c2233b5e950
+            24079a49666ddf642ee54a58e7bbec67a126788821d2f471fbc8fa7c8710190c
+            b43c7421452c87c9b931782f93ddb89553c897d207459578bac719e9069e1c21
+            baba6ee28de611760ceff1fddcaafe971aa5fa378211703746292d876c70c481
+            f1e0e96c3344768e6472f5ac418c325674a258010fe0cf83f2fcab4fbbe2b107
+            2fb8fa4c756f6947c0e7946e9aac52993311d55133347f6a7823604310e265dc
+            a00300770f002b96ef1a9e46154765dc3d453bef42617295900b2ac937464702
+            51e097ef51f82e5c1ca24c430f5f5de0f31141778ad3c508959be092f34e4a06
+            b57c2be4d6e54b9296ca744136eb41b7a933e54660c36f6e8a93b177e866df03
+            c75ccccb97c6f70a432cd431378200073500c10ea1c869ffcaa7e23975d4f6b0
+            cf302610793fab67643b047ef734883a3fbdf7b4aca04c96e02e31a078a57eed
+            ce61ce6c4a3161fdd24c763859920018fabb1f2c365abed52f67a75ea23018bb
+            319ab4a81b6172afb189fc6f6044e46302fa5da49cb44d5b9c5bfe4309de0b3b
+            9fb3313c471da0753c077c748f63aca9df0305c0578c91a73afe763dd7bbd60d
+            9b6604e23b6ef1d3f887f674cae770c39d4d16665f15fc7da979a51d54b5ae1a
+            448d6660e96a7790f9ddab16e2b92cc1899ef92822d19d7109828751c208d5ef
+            ea26ed6b0ce8a77eb2c79e261bad0358fbb82906135b479838e6bd61bfdc9c93
+            f6ae908e979bf453967def978f5ae7546b0cd828721d284cca394307b5fb2419
+            cb4efd75decabc683ba48167ff6c2cb652d61f0c31663c96dc5d3d47c201df49
+            f26461596c9356c41b8edec23ec2304f26d0fe3be5a502fc0df588d55f2ab754
+            410d8dfe4d7f452bd6ce4cc2d95d37faa26efed9c58fc7b57bea0d7ab7db09e7
+            da54a7f4f55b4ab4c78245d7763615c9f0a0a8e2e586fe088913126282a3393d
+            6cd949074c978ad57970317337b1479dd7c6ccb5c25af3373c1adda3c9ac7578
+            73b3ffc6b2cfac1252474550be113efcaac4abdc3d6fdd31d773a12ba838868a
+            3cb062b5d6926ca6a3071c20f2c7b22d8b86da9813460480490175f9c68b46b9
+            6713fd3f1acf6850bc5195ae66881138c2ae86fe1b0a89dac163e76cda94a44e
+            db3919073249caf311c95a2f30e3b2ad4c5c5109b4ca5bb6168a1b6ac5d60979
+            5b
+        `,
+        sharedKey:     "c034cb700c5e5ea072a257fe6c29a25858e5a85040473f8ffc197e1ad6c57a53",
+    },
+    {
+        seed:          "c6b726a8bbb0857c5c1c54f91197322554b37440589efb6798092ec4f2ed96c7",
+        publicKeyHash: "49622689ad8308e5fade9092bc86b805196697eef3d7728f5974ad5a2ed15a4a",
+        ciphertext:    `
+            01050f434873ffd7aa26793dd67e37a85659ae2e282ee4918392800a44982377
+            3494ce9f7009a27721abdcf64e8dd3d665bdf5b28cd261351def886f5a19b5d7
+            92604ada0d19a7e9351314e3820ddbb603cdc89f5cf9ca1874ac2a6584edc275
+            8c723f841b3e0181d25c13c5df90af12122a15268db4cf6d323055bd368728f9
+            21efb930fe22a6569286db0d04c3a397b741414026c9139be299148e6905e654
+            c9dd9a13c8fa7dc29b45d6aaad4340678eefb40cf12a8c6431085b97f11d12d1
+            17a03fc006b7cc0a0379dbf2cfed4f491e2a2c83c872e68e6343b562f178818e
+            91d9dd72644080d187a0ff0f87cee7e94a6ab011def80fd9f0e217f02e346ea1
+            4399cee203b89f1fe46da77846cff29e2d840d1700b9a173b19b64b7e8ca7782
+            4cbf9d8f916d5c01ceaadfdeadd0b5f5818c48a9e8c33dfe580b1bf0252fca8c
+            255422459c59d618c9acb179212f69402ecd05d9d08b8deca8639fbcb74c65be
+            8405dac9905ef5de44ab04093eb6f084054d0f6efb9e68429efa4a571e46ddd0
+            9bdad11ffbc416967a016e035f397692fd0997db7b054263b4ede17ece81d81a
+            5a7994b73f35e62f744e2381e674d95e96d0bad4a220ba64d85baefa34e2c23c
+            2629539b4cbaa30bff0a3112243bd845b6ff5c4664eefa717702ac0f4fe57bf4
+            df2cdfebbf900f87e5c64a89a6246f44feea01613f7be08d4958d651d34983c2
+            4d4cb07237351ee9a46e68cf562e18f9954239ac04db4844f29d1c243fa14dbf
+            a26f7b10aef326c3759fe286e4dea870beb048cd4f4e565ed673707ed5eecf02
+            6b98653aa2ae29c69df8212699da4eacf1beae258d9434e984398d8190c4a499
+            a7cf9cfa1947336b51838357f9393838349eec69412f009b4698be40583a6892
+            a071ec500b3d530f20c93d1f66c6a1eef220ef951251f0f5d95d2ae1738d3d17
+            111d0e07b79228a857c5bc8afbb489d37349c9e5e73affc46e0227c59d3a6c2e
+            854063ae80091bfba58d168d227ae63e53b61b2e90031c9df1c9e337f06719ed
+            a9117c17f7912f51917b31b6f912046190d8aa7984a04fb50e6e46a4411136d4
+            22b9f66e98b566fd9b82f4b7fe8d463fdaafc8a6b3c0f6dea23cf261e10b617f
+            36929b76d4ce2c0cda1204215bf098a592d589e646b67a7a280672f368e9bc1a
+            80e182fae992be308d0925e2c61232251089118c852c2ebca84101a8e178a005
+            22ef89b9d29c0002e290ed7ea03960be99cb850c7651fccb99a8796fe9a91c4a
+            0d92fd9ba615dfadc21e4f906e9e0630785089f558b10cefb4929514f9ccf25a
+            2f697dd0826b9c732fb0c7ec07f88c39809efb61b7dd3e5ff144182cd95532be
+            8d1298ecc32588b8d9cce02f4a60088a20d62ed39cf58b533bc657170102040f
+            f285966e9eae39592afe7114273ba4329e5ea17d9d3c807ee3159c16c9e13af2
+            558fa3cce391c97a39157667e440e71772afe928efce81d1c18246b9d8fc621a
+            e21bfc6d3c73acdbfe1b0468f8c40e0450d4ab0ca8c06ad4c796e62207ca5622
+            87803271afce14e5aa7c3e975dadb39ae40cf1a69f9d5bdc574d52eabaeaca3a
+            51
+        `,
+        sharedKey:     "c5f1564130ad5527db95c8f24cdf5760a0ce9b0c7f932eb5255bfa5b189c73d1",
+    },
+}
+
+// SelfTest checks the implementation against the known answers and runs a
+// fresh encapsulation round trip. The server refuses to start if it fails.
+func SelfTest() error {
+    for i, kat := range knownAnswers {
+        if err := kat.check(); err != nil {
+            return fmt.Errorf("known answer %d: %v", i, err)
+        }
+    }
+
+    sk, err := GenerateKey()
+    if err != nil {
+        return err
+    }
+    sharedKey, ciphertext, err := sk.PublicKey().Encapsulate()
+    if err != nil {
+        return err
+    }
+    recovered, err := sk.Decapsulate(ciphertext)
+    if err != nil {
+        return err
+    }
+    if !bytes.Equal(sharedKey, recovered) {
+        return fmt.Errorf("round trip: shared keys differ")
+    }
+    return nil
+}
+
+func (kat knownAnswer) check() error {
+    seed := mustHex(kat.seed)
+    sk, err := NewPrivateKey(seed)
+    if err != nil {
+        return err
+    }
+
+    parsed, err := ParsePrivateKey(sk.Bytes())
+    if err != nil || !bytes.Equal(parsed.seed[:], seed) {
+        return fmt.Errorf("private key does not round trip")
+    }
+
+    publicKey := sk.PublicKey().Bytes()
+    if hash := sha3.Sum256(publicKey); hex.EncodeToString(hash[:]) != kat.publicKeyHash {
+        return fmt.Errorf("public key mismatch")
+    }
+    pk, err := ParsePublicKey(publicKey)
+    if err != nil || !pk.Equal(sk.PublicKey()) {
+        return fmt.Errorf("public key does not round trip")
+    }
+
+    sharedKey, err := sk.Decapsulate(mustHex(kat.ciphertext))
+    if err != nil {
+        return err
+    }
+    if hex.EncodeToString(sharedKey) != kat.sharedKey {
+        return fmt.Errorf("shared key mismatch")
+    }
+    return nil
+}
+
+// mustHex decodes a hex vector, ignoring whitespace
+func mustHex(s string) []byte {
+    b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+    if err != nil {
+        panic(err)
+    }
+    return b
+}
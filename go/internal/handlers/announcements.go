@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"quantum-chat/internal/middleware"
+	"quantum-chat/internal/models"
+)
+
+// announcementRequest targets the given users, or every user with the given
+// role, or, with neither set, everyone
+type announcementRequest struct {
+    Content json.RawMessage `json:"content"`
+    UserIDs []int64         `json:"user_ids"`
+    Role    string          `json:"role"`
+}
+
+// announcementEvent is the content of an announcement's system message. The
+// message itself has no sender, so the admin is named here.
+type announcementEvent struct {
+    Event   string          `json:"event"`
+    UserID  int64           `json:"user_id"`
+    Content json.RawMessage `json:"content"`
+}
+
+const eventAnnouncement = "announcement"
+
+// handleAnnouncements serves POST /api/announcements. Admins only: the
+// announcement is stored as a system message, pushed over the hub's
+// broadcast channel to connected recipients and replayed to the others on
+// their next connect.
+func (h *Handlers) handleAnnouncements(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    userID, ok := middleware.GetUserIDFromContext(r.Context())
+    if !ok {
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    user, err := h.db.GetUserByID(userID)
+    if err != nil {
+        log.Printf("Error getting user: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if user == nil || user.Role != models.UserRoleAdmin {
+        http.Error(w, "Only admins can send announcements", http.StatusForbidden)
+        return
+    }
+
+    var req announcementRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+    if len(req.Content) == 0 {
+        http.Error(w, "content is required", http.StatusBadRequest)
+        return
+    }
+    if req.Role != "" && req.Role != models.UserRoleUser && req.Role != models.UserRoleAdmin {
+        http.Error(w, "role must be user or admin", http.StatusBadRequest)
+        return
+    }
+    targeted := len(req.UserIDs) > 0 || req.Role != ""
+
+    audience, err := h.db.GetAudienceUserIDs(uniqueIDs(req.UserIDs, 0), req.Role)
+    if err != nil {
+        log.Printf("Error resolving announcement audience: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    recipientIDs := uniqueIDs(audience, userID)
+    if len(recipientIDs) == 0 {
+        http.Error(w, "Announcement has no recipients", http.StatusBadRequest)
+        return
+    }
+
+    content, _ := json.Marshal(announcementEvent{
+        Event:   eventAnnouncement,
+        UserID:  userID,
+        Content: req.Content,
+    })
+    msg := &models.Message{
+        Content:   content,
+        Timestamp: time.Now().Unix(),
+    }
+    if err := h.db.SaveSystemMessage(msg, recipientIDs); err != nil {
+        log.Printf("Error saving announcement: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+
+    // The sender's devices get a copy as well
+    broadcast := &broadcastMessage{frame: chatFrame(msg)}
+    if targeted {
+        broadcast.audience = map[int64]bool{userID: true}
+        for _, id := range recipientIDs {
+            broadcast.audience[id] = true
+        }
+    }
+    h.hub.queueBroadcast(broadcast)
+
+    log.Printf("Announcement %d sent by %d to %d users", msg.ID, userID, len(recipientIDs))
+    writeJSON(w, http.StatusCreated, msg)
+}
@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"quantum-chat/internal/blobstore"
+	"quantum-chat/internal/middleware"
+	"quantum-chat/internal/models"
+)
+
+// Attachment limits
+const (
+    maxAttachmentSize        = 100 << 20
+    maxChunkSize             = 4 << 20
+    maxAttachmentsPerMessage = 10
+
+    // Attachments no message references are deleted once they were last
+    // uploaded this long ago, leaving time to send the message
+    attachmentGracePeriod = 7 * 24 * time.Hour
+)
+
+var (
+    errTooManyAttachments = errors.New("a message can reference at most 10 attachments")
+    errUnknownAttachment  = errors.New("unknown or duplicate attachment")
+)
+
+type createUploadRequest struct {
+    ConversationID int64 `json:"conversation_id"`
+    Size           int64 `json:"size"`
+}
+
+type uploadResponse struct {
+    Upload     *models.AttachmentUpload `json:"upload"`
+    Attachment *models.Attachment       `json:"attachment,omitempty"`
+}
+
+// handleAttachments serves /api/attachments/uploads, resumable uploads under
+// /api/attachments/uploads/{upload_id} and downloads of committed blobs
+// under /api/attachments/{id}
+func (h *Handlers) handleAttachments(w http.ResponseWriter, r *http.Request) {
+    userID, ok := middleware.GetUserIDFromContext(r.Context())
+    if !ok {
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    parts := pathSegments(r.URL.Path, "/api/attachments/")
+    switch {
+    case len(parts) == 1 && parts[0] == "uploads":
+        if r.Method != http.MethodPost {
+            http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+            return
+        }
+        h.createUpload(w, r, userID)
+    case len(parts) == 2 && parts[0] == "uploads":
+        h.handleUpload(w, r, userID, parts[1])
+    case len(parts) == 1:
+        if r.Method != http.MethodGet {
+            http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+            return
+        }
+        h.downloadAttachment(w, r, userID, parts[0])
+    default:
+        http.NotFound(w, r)
+    }
+}
+
+func (h *Handlers) createUpload(w http.ResponseWriter, r *http.Request, userID int64) {
+    var req createUploadRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+    if req.Size <= 0 || req.Size > maxAttachmentSize {
+        http.Error(w, "size must be between 1 and 104857600 bytes", http.StatusBadRequest)
+        return
+    }
+
+    member, err := h.db.GetConversationMember(req.ConversationID, userID)
+    if err != nil {
+        log.Printf("Error checking membership: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if member == nil {
+        http.Error(w, "Conversation not found", http.StatusNotFound)
+        return
+    }
+
+    id := make([]byte, 16)
+    rand.Read(id)
+    upload := &models.AttachmentUpload{
+        ID:             hex.EncodeToString(id),
+        UserID:         userID,
+        ConversationID: req.ConversationID,
+        Size:           req.Size,
+    }
+    if err := h.db.CreateUpload(upload); err != nil {
+        log.Printf("Error creating upload: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    writeJSON(w, http.StatusCreated, uploadResponse{Upload: upload})
+}
+
+// handleUpload reports the progress of an upload (GET), appends a chunk at
+// the offset given in the Upload-Offset header (PUT) or cancels it (DELETE).
+// The upload completes with the chunk that brings it to its full size; if
+// that fails, a PUT at the full size retries it.
+func (h *Handlers) handleUpload(w http.ResponseWriter, r *http.Request, userID int64, uploadID string) {
+    upload, err := h.db.GetUpload(uploadID)
+    if err != nil {
+        log.Printf("Error getting upload: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if upload == nil || upload.UserID != userID {
+        http.Error(w, "Upload not found", http.StatusNotFound)
+        return
+    }
+
+    switch r.Method {
+    case http.MethodGet:
+        if upload.AttachmentID != "" {
+            upload.Received = upload.Size
+        } else if upload.Received, err = h.blobs.Staged(upload.ID); err != nil {
+            log.Printf("Error reading upload progress: %v", err)
+            http.Error(w, "Internal server error", http.StatusInternalServerError)
+            return
+        }
+        writeJSON(w, http.StatusOK, uploadResponse{Upload: upload})
+
+    case http.MethodPut:
+        h.appendChunk(w, r, upload)
+
+    case http.MethodDelete:
+        if err := h.blobs.Abort(upload.ID); err != nil {
+            log.Printf("Error aborting upload: %v", err)
+        }
+        if err := h.db.DeleteUpload(upload.ID); err != nil {
+            log.Printf("Error deleting upload: %v", err)
+            http.Error(w, "Internal server error", http.StatusInternalServerError)
+            return
+        }
+        w.WriteHeader(http.StatusNoContent)
+
+    default:
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+    }
+}
+
+func (h *Handlers) appendChunk(w http.ResponseWriter, r *http.Request, upload *models.AttachmentUpload) {
+    if upload.AttachmentID != "" {
+        http.Error(w, "Upload already completed", http.StatusConflict)
+        return
+    }
+
+    offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+    if err != nil || offset < 0 || offset > upload.Size {
+        http.Error(w, "Invalid Upload-Offset", http.StatusBadRequest)
+        return
+    }
+
+    if offset == upload.Size {
+        // Every byte was staged before but completing the upload failed, so
+        // only the commit is retried
+        upload.Received, err = h.blobs.Staged(upload.ID)
+        if err == nil && upload.Received != upload.Size {
+            err = blobstore.ErrOffsetMismatch
+        }
+    } else {
+        limit := upload.Size - offset
+        if limit > maxChunkSize {
+            limit = maxChunkSize
+        }
+        body := http.MaxBytesReader(w, r.Body, limit)
+        upload.Received, err = h.blobs.Append(upload.ID, offset, body)
+    }
+    if errors.Is(err, blobstore.ErrOffsetMismatch) {
+        // Tell the client where to resume
+        writeJSON(w, http.StatusConflict, uploadResponse{Upload: upload})
+        return
+    }
+    var tooLarge *http.MaxBytesError
+    if errors.As(err, &tooLarge) {
+        http.Error(w, "Chunk is too large", http.StatusRequestEntityTooLarge)
+        return
+    }
+    if err != nil {
+        log.Printf("Error appending upload chunk: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+
+    if upload.Received < upload.Size {
+        writeJSON(w, http.StatusOK, uploadResponse{Upload: upload})
+        return
+    }
+
+    attachmentID, size, err := h.blobs.Commit(upload.ID)
+    if err != nil {
+        log.Printf("Error committing upload: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    attachment, err := h.db.CompleteUpload(upload, attachmentID, size)
+    if err != nil {
+        log.Printf("Error completing upload: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if err := h.blobs.Abort(upload.ID); err != nil {
+        log.Printf("Error removing staged upload: %v", err)
+    }
+    writeJSON(w, http.StatusCreated, uploadResponse{Upload: upload, Attachment: attachment})
+}
+
+// downloadAttachment streams a blob to the participants of a message that
+// references it. Once every such message is deleted or expired the blob is
+// gone for them too. Range requests are supported so downloads can resume.
+func (h *Handlers) downloadAttachment(w http.ResponseWriter, r *http.Request, userID int64, attachmentID string) {
+    allowed, err := h.db.CanAccessAttachment(attachmentID, userID, h.clock.Now())
+    if err != nil {
+        log.Printf("Error checking attachment access: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if !allowed {
+        http.Error(w, "Attachment not found", http.StatusNotFound)
+        return
+    }
+
+    blob, size, err := h.blobs.Open(attachmentID)
+    if errors.Is(err, blobstore.ErrNotFound) {
+        http.Error(w, "Attachment not found", http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        log.Printf("Error opening attachment: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    defer blob.Close()
+
+    w.Header().Set("Content-Type", "application/octet-stream")
+    w.Header().Set("ETag", `"`+attachmentID+`"`)
+    if seeker, ok := blob.(io.ReadSeeker); ok {
+        http.ServeContent(w, r, "", time.Time{}, seeker)
+        return
+    }
+    w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+    io.Copy(w, blob)
+}
+
+// validateAttachments checks that a chat message only references attachments
+// uploaded to its conversation
+func (h *Handlers) validateAttachments(convID int64, attachmentIDs []string) error {
+    if len(attachmentIDs) > maxAttachmentsPerMessage {
+        return errTooManyAttachments
+    }
+    seen := make(map[string]bool, len(attachmentIDs))
+    for _, id := range attachmentIDs {
+        if seen[id] {
+            return errUnknownAttachment
+        }
+        seen[id] = true
+    }
+
+    count, err := h.db.CountConversationAttachments(convID, attachmentIDs)
+    if err != nil {
+        return err
+    }
+    if count != len(attachmentIDs) {
+        return errUnknownAttachment
+    }
+    return nil
+}
+
+// collectAttachments deletes the blobs of attachments no message references
+// any more
+func (h *Handlers) collectAttachments() (int, error) {
+    before := h.clock.Now().Add(-attachmentGracePeriod)
+    total := 0
+    for {
+        ids, err := h.db.DeleteOrphanedAttachments(before, reaperBatchSize)
+        if err != nil {
+            return total, err
+        }
+        for _, id := range ids {
+            if err := h.blobs.Delete(id); err != nil {
+                log.Printf("Reaper: Error deleting blob %s: %v", id, err)
+            }
+        }
+        total += len(ids)
+
+        if len(ids) < reaperBatchSize {
+            return total, nil
+        }
+    }
+}
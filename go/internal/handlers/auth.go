@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"quantum-chat/internal/encryption"
 	"quantum-chat/internal/middleware"
 	"quantum-chat/internal/models"
 
@@ -126,7 +127,6 @@ func (h *Handlers) handleRegister(w http.ResponseWriter, r *http.Request) {
         Password:  string(hashedPassword),
         PublicKey: req.PublicKey,
     }
-
     if err := h.db.CreateUser(user); err != nil {
         log.Printf("Error creating user: %v", err)
         http.Error(w, "Error creating user", http.StatusInternalServerError)
@@ -205,6 +205,9 @@ func validateRegisterRequest(req registerRequest) error {
     if len(req.PublicKey) == 0 {
         return errors.New("public key is required")
     }
+    if _, err := encryption.ParsePublicKey(req.PublicKey); err != nil {
+        return errors.New("public key is not a supported key: " + err.Error())
+    }
     return nil
 }
 
@@ -239,10 +242,7 @@ func (h *Handlers) handleLogout(w http.ResponseWriter, r *http.Request) {
     middleware.RevokeToken(token, time.Unix(claims.ExpiresAt, 0))
 
     // Close any active WebSocket connections for this user
-    if client, ok := h.hub.clients[userID]; ok {
-        client.Conn.Close()
-        delete(h.hub.clients, userID)
-    }
+    h.hub.disconnectUser(userID)
 
     // Return success response
     w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"quantum-chat/internal/models"
+)
+
+// rejection is a chat message refused for a reason the sender should see
+type rejection struct {
+    reason string
+}
+
+func (r *rejection) Error() string { return r.reason }
+
+func reject(reason string) error {
+    return &rejection{reason: reason}
+}
+
+// chatConversation returns the conversation a chat frame from senderID is
+// addressed to, opening the direct conversation for a receiver_id if needed
+func (h *Handlers) chatConversation(senderID int64, wsMsg *WSMessage) (*models.Conversation, error) {
+    convID := wsMsg.ConversationID
+    if convID == 0 {
+        if wsMsg.ReceiverID == 0 {
+            return nil, reject("Message requires receiver_id or conversation_id")
+        }
+
+        receiver, err := h.db.GetUserByID(wsMsg.ReceiverID)
+        if err != nil {
+            return nil, fmt.Errorf("failed to look up receiver: %v", err)
+        }
+        if receiver == nil {
+            return nil, reject("Unknown receiver")
+        }
+        if err := h.checkDirectMessage(senderID, receiver.ID); err != nil {
+            return nil, contactRejection(err)
+        }
+
+        convID, err = h.db.GetOrCreateDirectConversation(senderID, wsMsg.ReceiverID)
+        if err != nil {
+            return nil, fmt.Errorf("failed to open direct conversation: %v", err)
+        }
+    }
+
+    conv, err := h.db.GetConversation(convID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to load conversation: %v", err)
+    }
+    if conv == nil || !isMember(conv, senderID) {
+        return nil, reject("Not a member of this conversation")
+    }
+    if !conv.IsGroup && wsMsg.ConversationID != 0 {
+        for _, member := range conv.Members {
+            if member.UserID == senderID {
+                continue
+            }
+            if err := h.checkDirectMessage(senderID, member.UserID); err != nil {
+                return nil, contactRejection(err)
+            }
+        }
+    }
+    return conv, nil
+}
+
+// contactRejection turns contact refusals into rejections
+func contactRejection(err error) error {
+    if isContactError(err) {
+        return reject(err.Error())
+    }
+    return fmt.Errorf("failed to check contact: %v", err)
+}
+
+// sendChatMessage stores a chat message from senderID and delivers it to the
+// conversation. origin is the device the message came from, or nil when the
+// server sends on the user's behalf; either way all of the sender's devices
+// get the ack and a copy. Reasons to refuse the message come back as
+// *rejection.
+func (h *Handlers) sendChatMessage(senderID int64, wsMsg *WSMessage, origin *Client) (*models.Message, error) {
+    if len(wsMsg.ClientMessageID) > maxClientMessageIDLength {
+        return nil, reject("client_message_id is too long")
+    }
+    if wsMsg.TTL < 0 || wsMsg.TTL > maxMessageTTL {
+        return nil, reject("ttl is out of range")
+    }
+
+    conv, err := h.chatConversation(senderID, wsMsg)
+    if err != nil {
+        return nil, err
+    }
+    if err := checkContent(conv, wsMsg.Content); err != nil {
+        return nil, err
+    }
+
+    if len(wsMsg.AttachmentIDs) > 0 {
+        err := h.validateAttachments(conv.ID, wsMsg.AttachmentIDs)
+        if err == errTooManyAttachments || err == errUnknownAttachment {
+            return nil, reject(err.Error())
+        }
+        if err != nil {
+            return nil, fmt.Errorf("failed to check attachments: %v", err)
+        }
+    }
+
+    var recipientIDs []int64
+    for _, member := range conv.Members {
+        if member.UserID != senderID {
+            recipientIDs = append(recipientIDs, member.UserID)
+        }
+    }
+
+    // Group members who blocked the sender do not get the message
+    if conv.IsGroup && len(recipientIDs) > 0 {
+        blockers, err := h.db.GetBlockerIDs(senderID, recipientIDs)
+        if err != nil {
+            return nil, fmt.Errorf("failed to check blocks: %v", err)
+        }
+        recipientIDs = withoutIDs(recipientIDs, blockers)
+    }
+
+    msg := &models.Message{
+        ConversationID:  conv.ID,
+        SenderID:        senderID,
+        ClientMessageID: wsMsg.ClientMessageID,
+        ReplyToID:       wsMsg.ReplyToMessageID,
+        ThreadRootID:    wsMsg.ThreadRootID,
+        Content:         wsMsg.Content,
+        Timestamp:       wsMsg.Timestamp,
+        Read:            false,
+        ExpiresAt:       h.messageExpiry(conv, wsMsg.TTL),
+        AttachmentIDs:   wsMsg.AttachmentIDs,
+    }
+    if !conv.IsGroup && len(recipientIDs) == 1 {
+        msg.ReceiverID = recipientIDs[0]
+    }
+
+    if err := h.resolveThreading(msg, senderID); err != nil {
+        if isThreadingError(err) {
+            return nil, reject(err.Error())
+        }
+        return nil, fmt.Errorf("failed to resolve message references: %v", err)
+    }
+
+    // Save message to database
+    created, err := h.db.SaveMessage(msg, recipientIDs)
+    if err != nil {
+        return nil, fmt.Errorf("failed to save message: %v", err)
+    }
+
+    // Tell the sender the message is stored; delivery and read acks follow
+    // as recipients confirm them. A retried send gets the ack again, but the
+    // original was fanned out already.
+    h.sendToSender(senderID, origin, ackFrame(senderID, msg.ID, models.DeliverySent))
+    if !created {
+        return msg, nil
+    }
+
+    // Fan the message out to every online member and echo it to the
+    // sender's other devices
+    wsMsg.SenderID = senderID
+    wsMsg.MessageID = msg.ID
+    wsMsg.ConversationID = msg.ConversationID
+    wsMsg.ReceiverID = msg.ReceiverID
+    wsMsg.Seq = msg.Seq
+    wsMsg.ThreadRootID = msg.ThreadRootID
+    wsMsg.TTL = 0
+    wsMsg.SendAt = 0
+    if msg.ExpiresAt != nil {
+        wsMsg.ExpiresAt = msg.ExpiresAt.Unix()
+    }
+    messageJSON, _ := json.Marshal(wsMsg)
+    h.hub.fanout(recipientIDs, messageJSON)
+    if origin != nil {
+        h.hub.sendToOtherDevices(origin, messageJSON)
+    } else {
+        h.hub.sendToUser(senderID, messageJSON)
+    }
+
+    return msg, nil
+}
+
+// sendToSender delivers a frame to every device of the sender, starting with
+// the originating device if there is one
+func (h *Handlers) sendToSender(senderID int64, origin *Client, frame []byte) {
+    if origin == nil {
+        h.hub.sendToUser(senderID, frame)
+        return
+    }
+    origin.send(frame)
+    h.hub.sendToOtherDevices(origin, frame)
+}
+
+// withoutIDs returns ids minus the excluded IDs
+func withoutIDs(ids, excluded []int64) []int64 {
+    if len(excluded) == 0 {
+        return ids
+    }
+    skip := make(map[int64]bool, len(excluded))
+    for _, id := range excluded {
+        skip[id] = true
+    }
+    var result []int64
+    for _, id := range ids {
+        if !skip[id] {
+            result = append(result, id)
+        }
+    }
+    return result
+}
@@ -2,30 +2,57 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"quantum-chat/internal/models"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 // newClient creates a new client instance
-func newClient(userID int64, conn *websocket.Conn, hub *Hub) *Client {
+func newClient(userID int64, deviceID string, conn *websocket.Conn, hub *Hub) *Client {
     return &Client{
-        UserID: userID,
-        Conn:   conn,
-        Send:   make(chan []byte, 256),
-        hub:    hub,
+        UserID:   userID,
+        DeviceID: deviceID,
+        Conn:     conn,
+        Send:     make(chan []byte, 256),
+        hub:      hub,
+        done:     make(chan struct{}),
+    }
+}
+
+// close signals the write pump and any pending senders that the client is gone
+func (c *Client) close() {
+    c.closeOnce.Do(func() {
+        close(c.done)
+    })
+}
+
+// send queues a frame for the client, giving up once the client is gone
+func (c *Client) send(message []byte) bool {
+    select {
+    case <-c.done:
+        return false
+    default:
+    }
+
+    select {
+    case c.Send <- message:
+        return true
+    case <-c.done:
+        return false
     }
 }
 
 // readPump pumps messages from the websocket connection to the hub.
 func (c *Client) readPump() {
     defer func() {
+        c.hub.typing.clientGone(c)
         c.hub.unregister <- c
         c.Conn.Close()
-        log.Printf("Client readPump: Client %d disconnected", c.UserID)
+        log.Printf("Client readPump: Client %d/%s disconnected", c.UserID, c.DeviceID)
     }()
 
     c.Conn.SetReadLimit(maxMessageSize)
@@ -61,6 +88,47 @@ func (c *Client) readPump() {
                 log.Printf("Client readPump: Error handling chat message: %v", err)
                 c.sendError("Failed to process message")
             }
+        case MessageTypeReactionAdd, MessageTypeReactionRemove:
+            if err := c.handleReaction(&wsMsg); err != nil {
+                log.Printf("Client readPump: Error handling reaction: %v", err)
+                c.sendError("Failed to process reaction")
+            }
+        case MessageTypeAck:
+            if err := c.handleClientAck(&wsMsg); err != nil {
+                log.Printf("Client readPump: Error handling ack: %v", err)
+                c.sendError("Failed to process ack")
+            }
+        case MessageTypeSync:
+            // Syncs can stream a lot, so keep reading (and handling pongs)
+            // while one runs, but never start a second
+            if !c.syncing.CompareAndSwap(false, true) {
+                c.sendError("Sync already in progress")
+                continue
+            }
+            go func() {
+                defer c.syncing.Store(false)
+                c.handleSync(wsMsg)
+            }()
+        case MessageTypeEdit:
+            if err := c.handleEditMessage(&wsMsg); err != nil {
+                log.Printf("Client readPump: Error handling edit: %v", err)
+                c.sendError("Failed to edit message")
+            }
+        case MessageTypeDelete:
+            if err := c.handleDeleteMessage(&wsMsg); err != nil {
+                log.Printf("Client readPump: Error handling delete: %v", err)
+                c.sendError("Failed to delete message")
+            }
+        case MessageTypeTypingStart, MessageTypeTypingStop:
+            if err := c.handleTyping(&wsMsg); err != nil {
+                log.Printf("Client readPump: Error handling typing event: %v", err)
+                c.sendError("Failed to process typing event")
+            }
+        case MessageTypeRead:
+            if err := c.handleReadMessage(&wsMsg); err != nil {
+                log.Printf("Client readPump: Error handling read message: %v", err)
+                c.sendError("Failed to mark messages read")
+            }
         default:
             c.sendError("Unknown message type")
         }
@@ -73,7 +141,7 @@ func (c *Client) writePump() {
     defer func() {
         ticker.Stop()
         c.Conn.Close()
-        log.Printf("Client writePump: Connection closed for client %d", c.UserID)
+        log.Printf("Client writePump: Connection closed for client %d/%s", c.UserID, c.DeviceID)
     }()
 
     for {
@@ -103,6 +171,11 @@ func (c *Client) writePump() {
                 return
             }
 
+        case <-c.done:
+            c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+            c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+            return
+
         case <-ticker.C:
             c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
             if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
@@ -112,32 +185,44 @@ func (c *Client) writePump() {
     }
 }
 
-// handleChatMessage processes incoming chat messages
+// handleChatMessage processes incoming chat messages. A message is addressed
+// either to a conversation or, for one-to-one chats, to a receiver ID. With
+// a future send_at the message is scheduled instead of sent.
 func (c *Client) handleChatMessage(wsMsg *WSMessage) error {
-    msg := &models.Message{
-        SenderID:   c.UserID,
-        ReceiverID: wsMsg.ReceiverID,
-        Content:    wsMsg.Content,
-        Timestamp:  wsMsg.Timestamp,
-        Read:       false,
+    if strings.HasPrefix(wsMsg.ClientMessageID, scheduledClientIDPrefix) {
+        c.sendError("client_message_id prefix is reserved")
+        return nil
     }
 
-    // Save message to database
-    if err := c.hub.handlers.db.SaveMessage(msg); err != nil {
-        return fmt.Errorf("failed to save message: %v", err)
+    var err error
+    if wsMsg.SendAt != 0 {
+        err = c.hub.handlers.scheduleChatMessage(c.UserID, wsMsg, c)
+    } else {
+        _, err = c.hub.handlers.sendChatMessage(c.UserID, wsMsg, c)
     }
 
-    // Send acknowledgment to sender
-    c.sendAck(msg.ID)
+    var rejected *rejection
+    if errors.As(err, &rejected) {
+        c.sendError(rejected.reason)
+        return nil
+    }
+    return err
+}
 
-    // Forward message to recipient if online
-    if recipient, ok := c.hub.clients[wsMsg.ReceiverID]; ok {
-        wsMsg.MessageID = msg.ID
-        messageJSON, _ := json.Marshal(wsMsg)
-        recipient.Send <- messageJSON
+// handleReadMessage marks messages read on behalf of the client
+func (c *Client) handleReadMessage(wsMsg *WSMessage) error {
+    var req readRequest
+    if err := json.Unmarshal(wsMsg.Content, &req); err != nil {
+        c.sendError("Invalid read request")
+        return nil
+    }
+    if err := req.validate(); err != nil {
+        c.sendError(err.Error())
+        return nil
     }
 
-    return nil
+    _, err := c.hub.handlers.markRead(c.UserID, req)
+    return err
 }
 
 // sendError sends an error message to the client
@@ -149,18 +234,17 @@ func (c *Client) sendError(message string) {
         Timestamp: time.Now().Unix(),
     }
     messageJSON, _ := json.Marshal(errorMsg)
-    c.Send <- messageJSON
+    c.send(messageJSON)
 }
 
-// sendAck sends a message acknowledgment to the client
-func (c *Client) sendAck(messageID int64) {
-    ack := WSMessage{
+// ackFrame reports the delivery status of a message to its sender
+func ackFrame(senderID, messageID int64, status string) []byte {
+    frame, _ := json.Marshal(WSMessage{
         Type:      MessageTypeAck,
-        Content:   json.RawMessage(fmt.Sprintf(`{"status":"delivered","message_id":%d}`, messageID)),
-        SenderID:  c.UserID,
+        Content:   json.RawMessage(fmt.Sprintf(`{"status":"%s","message_id":%d}`, status, messageID)),
+        SenderID:  senderID,
         Timestamp: time.Now().Unix(),
         MessageID: messageID,
-    }
-    messageJSON, _ := json.Marshal(ack)
-    c.Send <- messageJSON
-}
\ No newline at end of file
+    })
+    return frame
+}
@@ -0,0 +1,383 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"quantum-chat/internal/middleware"
+	"quantum-chat/internal/models"
+)
+
+var (
+    errBlocked          = errors.New("cannot contact this user")
+    errNotContact       = errors.New("user is not a contact; send a contact request first")
+    errRequestPending   = errors.New("contact request is waiting to be accepted")
+    errRequestsDisabled = errors.New("user does not accept message requests")
+    errRequestDeclined  = errors.New("message request was declined")
+    errSelfContact      = errors.New("cannot add yourself as a contact")
+)
+
+// Contact event actions
+const (
+    contactRequested = "requested"
+    contactAccepted  = "accepted"
+)
+
+type contactRequestBody struct {
+    UserID int64 `json:"user_id"`
+}
+
+// contactEvent is pushed to a user when someone asks them to become a
+// contact or accepts their request
+type contactEvent struct {
+    Action string `json:"action"`
+    UserID int64  `json:"user_id"`
+}
+
+// isContactError reports whether err is a contact refusal for the client
+func isContactError(err error) bool {
+    switch err {
+    case errBlocked, errNotContact, errRequestPending, errRequestsDisabled, errRequestDeclined, errSelfContact:
+        return true
+    }
+    return false
+}
+
+// requestContact asks addresseeID to become a contact of requesterID and
+// returns the resulting state. A pending request in the other direction is
+// accepted instead, so two users asking each other become contacts.
+func (h *Handlers) requestContact(requesterID, addresseeID int64) (string, error) {
+    if requesterID == addresseeID {
+        return "", errSelfContact
+    }
+
+    blocked, err := h.db.IsBlocked(requesterID, addresseeID)
+    if err != nil {
+        return "", err
+    }
+    if blocked {
+        return "", errBlocked
+    }
+
+    contact, err := h.db.IsContact(requesterID, addresseeID)
+    if err != nil || contact {
+        return models.ContactAccepted, err
+    }
+
+    accepted, err := h.db.RespondContactRequest(addresseeID, requesterID, models.ContactAccepted)
+    if err != nil {
+        return "", err
+    }
+    if accepted {
+        h.notifyContact(addresseeID, contactAccepted, requesterID)
+        return models.ContactAccepted, nil
+    }
+
+    existing, err := h.db.GetContactRequest(requesterID, addresseeID)
+    if err != nil {
+        return "", err
+    }
+    if existing != nil {
+        if existing.Status == models.ContactDeclined {
+            return "", errRequestDeclined
+        }
+        return existing.Status, nil
+    }
+
+    settings, err := h.db.GetPrivacySettings(addresseeID)
+    if err != nil {
+        return "", err
+    }
+    if settings == nil || settings.MessageRequests == models.VisibilityNobody {
+        return "", errRequestsDisabled
+    }
+
+    created, err := h.db.CreateContactRequest(requesterID, addresseeID)
+    if err != nil {
+        return "", err
+    }
+    if created {
+        h.notifyContact(addresseeID, contactRequested, requesterID)
+    }
+    return models.ContactPending, nil
+}
+
+// checkDirectMessage decides whether senderID may message peerID directly,
+// without changing anything. Only contacts may; anyone else has to send a
+// contact request and wait for it to be accepted.
+func (h *Handlers) checkDirectMessage(senderID, peerID int64) error {
+    if senderID == peerID {
+        return nil
+    }
+
+    blocked, err := h.db.IsBlocked(senderID, peerID)
+    if err != nil {
+        return err
+    }
+    if blocked {
+        return errBlocked
+    }
+
+    contact, err := h.db.IsContact(senderID, peerID)
+    if err != nil || contact {
+        return err
+    }
+
+    existing, err := h.db.GetContactRequest(senderID, peerID)
+    if err != nil {
+        return err
+    }
+    switch {
+    case existing == nil:
+        return errNotContact
+    case existing.Status == models.ContactDeclined:
+        return errRequestDeclined
+    default:
+        return errRequestPending
+    }
+}
+
+func (h *Handlers) notifyContact(userID int64, action string, otherID int64) {
+    content, _ := json.Marshal(contactEvent{Action: action, UserID: otherID})
+    frame, _ := json.Marshal(WSMessage{
+        Type:      MessageTypeContact,
+        Content:   content,
+        SenderID:  otherID,
+        Timestamp: time.Now().Unix(),
+    })
+    h.hub.sendToUser(userID, frame)
+}
+
+// handleContacts serves GET /api/contacts
+func (h *Handlers) handleContacts(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    userID, ok := middleware.GetUserIDFromContext(r.Context())
+    if !ok {
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    contacts, err := h.db.GetContacts(userID)
+    if err != nil {
+        log.Printf("Error listing contacts: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if contacts == nil {
+        contacts = []*models.Contact{}
+    }
+    writeJSON(w, http.StatusOK, contacts)
+}
+
+// handleContact serves /api/contacts/requests, the accept and decline
+// actions under /api/contacts/requests/{user_id}/ and DELETE
+// /api/contacts/{user_id}
+func (h *Handlers) handleContact(w http.ResponseWriter, r *http.Request) {
+    userID, ok := middleware.GetUserIDFromContext(r.Context())
+    if !ok {
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    parts := pathSegments(r.URL.Path, "/api/contacts/")
+    switch {
+    case len(parts) == 1 && parts[0] == "requests":
+        switch r.Method {
+        case http.MethodGet:
+            h.listContactRequests(w, userID)
+        case http.MethodPost:
+            h.createContactRequest(w, r, userID)
+        default:
+            http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        }
+
+    case len(parts) == 3 && parts[0] == "requests":
+        if r.Method != http.MethodPost {
+            http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+            return
+        }
+        requesterID, err := parseID(parts[1])
+        if err != nil {
+            http.Error(w, "Invalid user ID", http.StatusBadRequest)
+            return
+        }
+        switch parts[2] {
+        case "accept":
+            h.respondContactRequest(w, requesterID, userID, models.ContactAccepted)
+        case "decline":
+            h.respondContactRequest(w, requesterID, userID, models.ContactDeclined)
+        default:
+            http.NotFound(w, r)
+        }
+
+    case len(parts) == 1:
+        if r.Method != http.MethodDelete {
+            http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+            return
+        }
+        otherID, err := parseID(parts[0])
+        if err != nil {
+            http.Error(w, "Invalid user ID", http.StatusBadRequest)
+            return
+        }
+        removed, err := h.db.RemoveContact(userID, otherID)
+        if err != nil {
+            log.Printf("Error removing contact: %v", err)
+            http.Error(w, "Internal server error", http.StatusInternalServerError)
+            return
+        }
+        if !removed {
+            http.Error(w, "Contact not found", http.StatusNotFound)
+            return
+        }
+        w.WriteHeader(http.StatusNoContent)
+
+    default:
+        http.NotFound(w, r)
+    }
+}
+
+func (h *Handlers) listContactRequests(w http.ResponseWriter, userID int64) {
+    requests, err := h.db.GetPendingContactRequests(userID)
+    if err != nil {
+        log.Printf("Error listing contact requests: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if requests == nil {
+        requests = []*models.ContactRequest{}
+    }
+    writeJSON(w, http.StatusOK, requests)
+}
+
+func (h *Handlers) createContactRequest(w http.ResponseWriter, r *http.Request, userID int64) {
+    var req contactRequestBody
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID <= 0 {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+
+    target, err := h.db.GetUserByID(req.UserID)
+    if err != nil {
+        log.Printf("Error getting user: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if target == nil {
+        http.Error(w, "User not found", http.StatusNotFound)
+        return
+    }
+
+    status, err := h.requestContact(userID, req.UserID)
+    if isContactError(err) {
+        http.Error(w, err.Error(), http.StatusForbidden)
+        return
+    }
+    if err != nil {
+        log.Printf("Error requesting contact: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]interface{}{"user_id": req.UserID, "status": status})
+}
+
+// respondContactRequest lets the addressee accept or decline a pending
+// request. Declines are not announced to the requester.
+func (h *Handlers) respondContactRequest(w http.ResponseWriter, requesterID, addresseeID int64, status string) {
+    responded, err := h.db.RespondContactRequest(requesterID, addresseeID, status)
+    if err != nil {
+        log.Printf("Error responding to contact request: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if !responded {
+        http.Error(w, "Contact request not found", http.StatusNotFound)
+        return
+    }
+
+    if status == models.ContactAccepted {
+        h.notifyContact(requesterID, contactAccepted, addresseeID)
+    }
+    writeJSON(w, http.StatusOK, map[string]interface{}{"user_id": requesterID, "status": status})
+}
+
+// handleBlocks serves GET /api/blocks
+func (h *Handlers) handleBlocks(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    userID, ok := middleware.GetUserIDFromContext(r.Context())
+    if !ok {
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    blocked, err := h.db.GetBlockedUsers(userID)
+    if err != nil {
+        log.Printf("Error listing blocked users: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if blocked == nil {
+        blocked = []*models.Contact{}
+    }
+    writeJSON(w, http.StatusOK, blocked)
+}
+
+// handleBlock serves PUT and DELETE /api/blocks/{user_id}
+func (h *Handlers) handleBlock(w http.ResponseWriter, r *http.Request) {
+    userID, ok := middleware.GetUserIDFromContext(r.Context())
+    if !ok {
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    parts := pathSegments(r.URL.Path, "/api/blocks/")
+    if len(parts) != 1 {
+        http.NotFound(w, r)
+        return
+    }
+    blockedID, err := parseID(parts[0])
+    if err != nil || blockedID == userID {
+        http.Error(w, "Invalid user ID", http.StatusBadRequest)
+        return
+    }
+
+    switch r.Method {
+    case http.MethodPut, http.MethodPost:
+        if !h.usersExist(w, []int64{blockedID}) {
+            return
+        }
+        if err := h.db.BlockUser(userID, blockedID); err != nil {
+            log.Printf("Error blocking user: %v", err)
+            http.Error(w, "Internal server error", http.StatusInternalServerError)
+            return
+        }
+        w.WriteHeader(http.StatusNoContent)
+
+    case http.MethodDelete:
+        unblocked, err := h.db.UnblockUser(userID, blockedID)
+        if err != nil {
+            log.Printf("Error unblocking user: %v", err)
+            http.Error(w, "Internal server error", http.StatusInternalServerError)
+            return
+        }
+        if !unblocked {
+            http.Error(w, "User is not blocked", http.StatusNotFound)
+            return
+        }
+        w.WriteHeader(http.StatusNoContent)
+
+    default:
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+    }
+}
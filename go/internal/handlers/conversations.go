@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"quantum-chat/internal/middleware"
+	"quantum-chat/internal/models"
+	"quantum-chat/internal/repository"
+)
+
+const maxGroupNameLength = 255
+
+type createConversationRequest struct {
+    Name      string  `json:"name"`
+    MemberIDs []int64 `json:"member_ids"`
+}
+
+type updateConversationRequest struct {
+    Name string `json:"name"`
+}
+
+type addMembersRequest struct {
+    UserIDs []int64 `json:"user_ids"`
+}
+
+// handleConversations serves /api/conversations
+func (h *Handlers) handleConversations(w http.ResponseWriter, r *http.Request) {
+    userID, ok := middleware.GetUserIDFromContext(r.Context())
+    if !ok {
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    switch r.Method {
+    case http.MethodGet:
+        conversations, err := h.db.GetUserConversations(userID)
+        if err != nil {
+            log.Printf("Error listing conversations: %v", err)
+            http.Error(w, "Internal server error", http.StatusInternalServerError)
+            return
+        }
+        if conversations == nil {
+            conversations = []*models.Conversation{}
+        }
+        writeJSON(w, http.StatusOK, conversations)
+
+    case http.MethodPost:
+        h.createConversation(w, r, userID)
+
+    default:
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+    }
+}
+
+// handleConversation serves /api/conversations/{id} and its sub-resources
+func (h *Handlers) handleConversation(w http.ResponseWriter, r *http.Request) {
+    userID, ok := middleware.GetUserIDFromContext(r.Context())
+    if !ok {
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    parts := pathSegments(r.URL.Path, "/api/conversations/")
+    if len(parts) == 0 {
+        http.NotFound(w, r)
+        return
+    }
+    convID, err := parseID(parts[0])
+    if err != nil {
+        http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+        return
+    }
+
+    conv, err := h.db.GetConversation(convID)
+    if err != nil {
+        log.Printf("Error getting conversation: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    // Non-members get the same answer as for a missing conversation
+    if conv == nil || !isMember(conv, userID) {
+        http.Error(w, "Conversation not found", http.StatusNotFound)
+        return
+    }
+
+    switch {
+    case len(parts) == 1 && r.Method == http.MethodGet:
+        writeJSON(w, http.StatusOK, conv)
+    case len(parts) == 1 && (r.Method == http.MethodPatch || r.Method == http.MethodPut):
+        h.updateConversation(w, r, conv, userID)
+    case len(parts) == 2 && parts[1] == "messages" && r.Method == http.MethodGet:
+        h.serveHistory(w, r, repository.MessageQuery{UserID: userID, ConversationID: conv.ID})
+    case len(parts) == 2 && parts[1] == "ttl" && r.Method == http.MethodPut:
+        h.handleMessageTTL(w, r, conv, userID)
+    case len(parts) == 2 && parts[1] == "e2e" && r.Method == http.MethodPut:
+        h.handleE2ERequired(w, r, conv, userID)
+    case len(parts) == 2 && parts[1] == "threads" && r.Method == http.MethodGet:
+        h.handleThreads(w, r, conv, userID)
+    case len(parts) == 3 && parts[1] == "threads" && r.Method == http.MethodGet:
+        rootID, err := parseID(parts[2])
+        if err != nil {
+            http.Error(w, "Invalid message ID", http.StatusBadRequest)
+            return
+        }
+        h.handleThreadMessages(w, r, conv, userID, rootID)
+    case len(parts) == 2 && parts[1] == "members" && r.Method == http.MethodPost:
+        h.addConversationMembers(w, r, conv, userID)
+    case len(parts) == 3 && parts[1] == "members" && r.Method == http.MethodDelete:
+        memberID, err := parseID(parts[2])
+        if err != nil {
+            http.Error(w, "Invalid user ID", http.StatusBadRequest)
+            return
+        }
+        h.removeConversationMember(w, conv, userID, memberID)
+    case len(parts) <= 3:
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+    default:
+        http.NotFound(w, r)
+    }
+}
+
+func (h *Handlers) createConversation(w http.ResponseWriter, r *http.Request, userID int64) {
+    var req createConversationRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+
+    req.Name = strings.TrimSpace(req.Name)
+    if err := validateGroupName(req.Name); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    memberIDs := uniqueIDs(req.MemberIDs, userID)
+    if len(memberIDs) == 0 {
+        http.Error(w, "A group needs at least one other member", http.StatusBadRequest)
+        return
+    }
+    if !h.usersExist(w, memberIDs) || !h.canAddMembers(w, userID, memberIDs) {
+        return
+    }
+
+    conv := &models.Conversation{
+        Name:      req.Name,
+        CreatedBy: userID,
+    }
+    if err := h.db.CreateConversation(conv, memberIDs); err != nil {
+        log.Printf("Error creating conversation: %v", err)
+        http.Error(w, "Error creating conversation", http.StatusInternalServerError)
+        return
+    }
+
+    created, err := h.db.GetConversation(conv.ID)
+    if err != nil {
+        log.Printf("Error loading conversation: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    writeJSON(w, http.StatusCreated, created)
+}
+
+func (h *Handlers) updateConversation(w http.ResponseWriter, r *http.Request, conv *models.Conversation, userID int64) {
+    if !h.requireGroupAdmin(w, conv, userID) {
+        return
+    }
+
+    var req updateConversationRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+    req.Name = strings.TrimSpace(req.Name)
+    if err := validateGroupName(req.Name); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    if err := h.db.RenameConversation(conv.ID, req.Name); err != nil {
+        log.Printf("Error renaming conversation: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    conv.Name = req.Name
+    writeJSON(w, http.StatusOK, conv)
+}
+
+func (h *Handlers) addConversationMembers(w http.ResponseWriter, r *http.Request, conv *models.Conversation, userID int64) {
+    if !h.requireGroupAdmin(w, conv, userID) {
+        return
+    }
+
+    var req addMembersRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+
+    userIDs := uniqueIDs(req.UserIDs, userID)
+    if len(userIDs) == 0 {
+        http.Error(w, "user_ids is required", http.StatusBadRequest)
+        return
+    }
+    if !h.usersExist(w, userIDs) || !h.canAddMembers(w, userID, userIDs) {
+        return
+    }
+
+    if err := h.db.AddConversationMembers(conv.ID, userIDs); err != nil {
+        log.Printf("Error adding conversation members: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    h.members.invalidate(conv.ID)
+    h.writeConversation(w, conv.ID)
+}
+
+// removeConversationMember lets admins remove anyone and members leave on their own
+func (h *Handlers) removeConversationMember(w http.ResponseWriter, conv *models.Conversation, userID, memberID int64) {
+    if !conv.IsGroup {
+        http.Error(w, "Not a group conversation", http.StatusBadRequest)
+        return
+    }
+    if memberID != userID && memberRole(conv, userID) != models.RoleAdmin {
+        http.Error(w, "Only group admins can remove members", http.StatusForbidden)
+        return
+    }
+    if !isMember(conv, memberID) {
+        http.Error(w, "User is not a member", http.StatusNotFound)
+        return
+    }
+
+    if err := h.db.RemoveConversationMember(conv.ID, memberID); err != nil {
+        log.Printf("Error removing conversation member: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    h.members.invalidate(conv.ID)
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// notifyConversationUpdated pushes the conversation to all of its members
+func (h *Handlers) notifyConversationUpdated(conv *models.Conversation) {
+    content, _ := json.Marshal(conv)
+    frame, _ := json.Marshal(WSMessage{
+        Type:           MessageTypeConversation,
+        Content:        content,
+        ConversationID: conv.ID,
+        Timestamp:      h.clock.Now().Unix(),
+    })
+    memberIDs := make([]int64, 0, len(conv.Members))
+    for _, member := range conv.Members {
+        memberIDs = append(memberIDs, member.UserID)
+    }
+    h.hub.fanout(memberIDs, frame)
+}
+
+func (h *Handlers) writeConversation(w http.ResponseWriter, convID int64) {
+    conv, err := h.db.GetConversation(convID)
+    if err != nil {
+        log.Printf("Error loading conversation: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    writeJSON(w, http.StatusOK, conv)
+}
+
+func (h *Handlers) requireGroupAdmin(w http.ResponseWriter, conv *models.Conversation, userID int64) bool {
+    if !conv.IsGroup {
+        http.Error(w, "Not a group conversation", http.StatusBadRequest)
+        return false
+    }
+    if memberRole(conv, userID) != models.RoleAdmin {
+        http.Error(w, "Only group admins can manage the group", http.StatusForbidden)
+        return false
+    }
+    return true
+}
+
+func (h *Handlers) usersExist(w http.ResponseWriter, userIDs []int64) bool {
+    count, err := h.db.CountExistingUsers(userIDs)
+    if err != nil {
+        log.Printf("Error checking users: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return false
+    }
+    if count != len(userIDs) {
+        http.Error(w, "Unknown user ID", http.StatusBadRequest)
+        return false
+    }
+    return true
+}
+
+// canAddMembers applies the direct message check to every user the adder
+// wants to put into a group, so groups are no way around blocks and requests
+func (h *Handlers) canAddMembers(w http.ResponseWriter, adderID int64, userIDs []int64) bool {
+    for _, id := range userIDs {
+        err := h.checkDirectMessage(adderID, id)
+        if isContactError(err) {
+            http.Error(w, fmt.Sprintf("Cannot add user %d: %v", id, err), http.StatusForbidden)
+            return false
+        }
+        if err != nil {
+            log.Printf("Error checking contact: %v", err)
+            http.Error(w, "Internal server error", http.StatusInternalServerError)
+            return false
+        }
+    }
+    return true
+}
+
+func validateGroupName(name string) error {
+    if name == "" {
+        return errors.New("name is required")
+    }
+    if len(name) > maxGroupNameLength {
+        return errors.New("name must not exceed 255 characters")
+    }
+    return nil
+}
+
+func isMember(conv *models.Conversation, userID int64) bool {
+    return memberRole(conv, userID) != ""
+}
+
+func memberRole(conv *models.Conversation, userID int64) string {
+    for _, member := range conv.Members {
+        if member.UserID == userID {
+            return member.Role
+        }
+    }
+    return ""
+}
+
+// uniqueIDs drops duplicates, non-positive IDs and the excluded ID
+func uniqueIDs(ids []int64, exclude int64) []int64 {
+    seen := make(map[int64]bool, len(ids))
+    var result []int64
+    for _, id := range ids {
+        if id <= 0 || id == exclude || seen[id] {
+            continue
+        }
+        seen[id] = true
+        result = append(result, id)
+    }
+    return result
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"quantum-chat/internal/models"
+)
+
+var errInvalidScope = errors.New("scope must be me or everyone")
+
+// deleteMessage deletes a message for the user only, or, for its sender, for
+// every participant
+func (h *Handlers) deleteMessage(userID, messageID int64, scope string) error {
+    switch scope {
+    case models.DeleteForEveryone:
+        if _, err := h.requireSender(userID, messageID); err != nil {
+            return err
+        }
+        msg, err := h.db.DeleteMessageForEveryone(messageID, userID)
+        if err != nil {
+            return err
+        }
+        if msg == nil {
+            return errMessageNotFound
+        }
+
+        recipients, err := h.db.GetMessageRecipientIDs(messageID)
+        if err != nil {
+            return err
+        }
+        frame := deletedFrame(msg, userID, models.DeleteForEveryone)
+        h.hub.fanout(recipients, frame)
+        h.hub.sendToUser(userID, frame)
+        return nil
+
+    case models.DeleteForMe:
+        participant, err := h.db.IsMessageParticipant(messageID, userID)
+        if err != nil {
+            return err
+        }
+        if !participant {
+            return errMessageNotFound
+        }
+        if err := h.db.HideMessage(messageID, userID); err != nil {
+            return err
+        }
+
+        // Keep the user's other devices in sync
+        msg, err := h.db.GetMessage(messageID)
+        if err != nil || msg == nil {
+            return err
+        }
+        h.hub.sendToUser(userID, deletedFrame(msg, userID, models.DeleteForMe))
+        return nil
+
+    default:
+        return errInvalidScope
+    }
+}
+
+// deletedFrame tells clients to drop their copy of a message
+func deletedFrame(msg *models.Message, actorID int64, scope string) []byte {
+    frame, _ := json.Marshal(WSMessage{
+        Type:           MessageTypeDeleted,
+        Content:        json.RawMessage(fmt.Sprintf(`{"scope":"%s"}`, scope)),
+        ReceiverID:     msg.ReceiverID,
+        ConversationID: msg.ConversationID,
+        SenderID:       actorID,
+        Timestamp:      time.Now().Unix(),
+        MessageID:      msg.ID,
+        Seq:            msg.Seq,
+    })
+    return frame
+}
+
+// handleDeleteMessage applies a delete frame from the client; the scope is
+// read from the frame content and defaults to "me"
+func (c *Client) handleDeleteMessage(wsMsg *WSMessage) error {
+    if wsMsg.MessageID == 0 {
+        c.sendError("Delete requires message_id")
+        return nil
+    }
+
+    req := struct {
+        Scope string `json:"scope"`
+    }{Scope: models.DeleteForMe}
+    if len(wsMsg.Content) > 0 {
+        if err := json.Unmarshal(wsMsg.Content, &req); err != nil {
+            c.sendError("Invalid delete request")
+            return nil
+        }
+    }
+
+    err := c.hub.handlers.deleteMessage(c.UserID, wsMsg.MessageID, req.Scope)
+    switch err {
+    case nil:
+        return nil
+    case errMessageNotFound, errNotSender, errSystemMessage, errInvalidScope:
+        c.sendError(err.Error())
+        return nil
+    default:
+        return err
+    }
+}
+
+// handleDeleteMessageREST serves DELETE /api/messages/{id}?scope=me|everyone
+func (h *Handlers) handleDeleteMessageREST(w http.ResponseWriter, r *http.Request, userID, messageID int64) {
+    scope := r.URL.Query().Get("scope")
+    if scope == "" {
+        scope = models.DeleteForMe
+    }
+
+    if err := h.deleteMessage(userID, messageID, scope); err != nil {
+        writeMessageError(w, err)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+
+	"quantum-chat/internal/models"
+)
+
+// Number of pending messages loaded per replay query
+const replayBatchSize = 100
+
+// ackRequest is the optional content of a client ack frame, used to confirm
+// several messages at once
+type ackRequest struct {
+    MessageIDs []int64 `json:"message_ids"`
+}
+
+// replayPending streams every message still waiting for delivery to the
+// client, oldest first. Messages stay pending until the client acks them, so
+// anything lost with the connection is replayed again on the next connect.
+func (c *Client) replayPending() {
+    db := c.hub.handlers.db
+
+    var cursor int64
+    for {
+        messages, err := db.GetPendingMessages(c.UserID, cursor, replayBatchSize, c.hub.handlers.clock.Now())
+        if err != nil {
+            log.Printf("Client replay: Error loading pending messages for %d: %v", c.UserID, err)
+            return
+        }
+
+        for _, msg := range messages {
+            if !c.send(chatFrame(msg)) {
+                return
+            }
+            cursor = msg.ID
+        }
+
+        if len(messages) < replayBatchSize {
+            if cursor != 0 {
+                log.Printf("Client replay: Replayed pending messages for %d up to %d", c.UserID, cursor)
+            }
+            return
+        }
+    }
+}
+
+// handleClientAck marks messages delivered once the client confirms receipt,
+// either of the frame's message_id or of every ID in its content
+func (c *Client) handleClientAck(wsMsg *WSMessage) error {
+    var req ackRequest
+    if len(wsMsg.Content) > 0 {
+        if err := json.Unmarshal(wsMsg.Content, &req); err != nil {
+            c.sendError("Invalid ack")
+            return nil
+        }
+    }
+    if wsMsg.MessageID != 0 {
+        req.MessageIDs = append(req.MessageIDs, wsMsg.MessageID)
+    }
+    if len(req.MessageIDs) == 0 {
+        c.sendError("Ack requires message_id")
+        return nil
+    }
+
+    receipts, err := c.hub.handlers.db.MarkMessagesDelivered(c.UserID, req.MessageIDs)
+    if err != nil {
+        return err
+    }
+    c.hub.handlers.notifyTransitions(receipts)
+    return nil
+}
+
+// chatFrame encodes a stored message as the chat or system frame recipients
+// receive live, or as a deleted frame for tombstones
+func chatFrame(msg *models.Message) []byte {
+    if msg.DeletedAt != nil {
+        return deletedFrame(msg, msg.SenderID, models.DeleteForEveryone)
+    }
+
+    messageType := MessageTypeChat
+    switch msg.Type {
+    case models.MessageTypeSystem:
+        messageType = MessageTypeSystem
+    case models.MessageTypeSealed:
+        messageType = MessageTypeSealed
+    }
+    var expiresAt int64
+    if msg.ExpiresAt != nil {
+        expiresAt = msg.ExpiresAt.Unix()
+    }
+    frame, _ := json.Marshal(WSMessage{
+        Type:             messageType,
+        Content:          msg.Content,
+        ReceiverID:       msg.ReceiverID,
+        ConversationID:   msg.ConversationID,
+        SenderID:         msg.SenderID,
+        Timestamp:        msg.Timestamp,
+        MessageID:        msg.ID,
+        Seq:              msg.Seq,
+        Version:          msg.Version,
+        ReplyToMessageID: msg.ReplyToID,
+        ThreadRootID:     msg.ThreadRootID,
+        ExpiresAt:        expiresAt,
+        AttachmentIDs:    msg.AttachmentIDs,
+        ClientMessageID:  msg.ClientMessageID,
+    })
+    return frame
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"quantum-chat/internal/models"
+)
+
+var (
+    errMessageNotFound  = errors.New("message not found")
+    errNotSender        = errors.New("only the sender can change this message")
+    errSystemMessage    = errors.New("system messages cannot be changed")
+    errEditWindowClosed = errors.New("edit window has closed")
+    errEmptyContent     = errors.New("content is required")
+)
+
+type editRequest struct {
+    Content json.RawMessage `json:"content"`
+}
+
+// editMessage replaces the content of a message with a new version and
+// pushes it to every participant's devices
+func (h *Handlers) editMessage(userID, messageID int64, content json.RawMessage) (*models.Message, error) {
+    if len(content) == 0 {
+        return nil, errEmptyContent
+    }
+
+    msg, err := h.requireSender(userID, messageID)
+    if err != nil {
+        return nil, err
+    }
+
+    if h.isExpired(msg) {
+        return nil, errMessageNotFound
+    }
+
+    sentAt := time.Unix(msg.Timestamp, 0)
+    if h.config.EditWindow > 0 && h.clock.Now().Sub(sentAt) > h.config.EditWindow {
+        return nil, errEditWindowClosed
+    }
+
+    conv, err := h.db.GetConversation(msg.ConversationID)
+    if err != nil {
+        return nil, err
+    }
+    if err := checkContent(conv, content); err != nil {
+        return nil, err
+    }
+
+    edited, err := h.db.EditMessage(messageID, userID, content)
+    if err != nil {
+        return nil, err
+    }
+    if edited == nil {
+        return nil, errMessageNotFound
+    }
+
+    recipients, err := h.db.GetMessageRecipientIDs(messageID)
+    if err != nil {
+        return nil, err
+    }
+
+    frame, _ := json.Marshal(WSMessage{
+        Type:           MessageTypeEdited,
+        Content:        edited.Content,
+        ReceiverID:     edited.ReceiverID,
+        ConversationID: edited.ConversationID,
+        SenderID:       userID,
+        Timestamp:      time.Now().Unix(),
+        MessageID:      edited.ID,
+        Seq:            edited.Seq,
+        Version:        edited.Version,
+    })
+    h.hub.fanout(recipients, frame)
+    h.hub.sendToUser(userID, frame)
+
+    return edited, nil
+}
+
+// requireSender loads a message the user may change. Users who cannot see the
+// message at all are told it does not exist; system messages belong to nobody.
+func (h *Handlers) requireSender(userID, messageID int64) (*models.Message, error) {
+    msg, err := h.db.GetMessage(messageID)
+    if err != nil {
+        return nil, err
+    }
+    if msg == nil {
+        return nil, errMessageNotFound
+    }
+    if msg.SenderID != userID || msg.Type == models.MessageTypeSystem {
+        participant, err := h.db.IsMessageParticipant(messageID, userID)
+        if err != nil {
+            return nil, err
+        }
+        if !participant {
+            return nil, errMessageNotFound
+        }
+        if msg.Type == models.MessageTypeSystem {
+            return nil, errSystemMessage
+        }
+        return nil, errNotSender
+    }
+    return msg, nil
+}
+
+// handleEditMessage applies an edit frame from the client
+func (c *Client) handleEditMessage(wsMsg *WSMessage) error {
+    if wsMsg.MessageID == 0 {
+        c.sendError("Edit requires message_id")
+        return nil
+    }
+
+    _, err := c.hub.handlers.editMessage(c.UserID, wsMsg.MessageID, wsMsg.Content)
+    var rejected *rejection
+    switch {
+    case err == nil:
+        return nil
+    case err == errMessageNotFound, err == errNotSender, err == errSystemMessage, err == errEditWindowClosed, err == errEmptyContent:
+        c.sendError(err.Error())
+        return nil
+    case errors.As(err, &rejected):
+        c.sendError(rejected.reason)
+        return nil
+    default:
+        return err
+    }
+}
+
+// handleEditMessageREST serves PUT /api/messages/{id}
+func (h *Handlers) handleEditMessageREST(w http.ResponseWriter, r *http.Request, userID, messageID int64) {
+    var req editRequest
+    r.Body = http.MaxBytesReader(w, r.Body, maxMessageSize)
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+
+    edited, err := h.editMessage(userID, messageID, req.Content)
+    if err != nil {
+        writeMessageError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, edited)
+}
+
+// handleMessageRevisions serves GET /api/messages/{id}/revisions
+func (h *Handlers) handleMessageRevisions(w http.ResponseWriter, r *http.Request, userID, messageID int64) {
+    if r.Method != http.MethodGet {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    participant, err := h.db.IsMessageParticipant(messageID, userID)
+    if err != nil {
+        log.Printf("Error checking message participant: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if !participant {
+        http.Error(w, "Message not found", http.StatusNotFound)
+        return
+    }
+
+    revisions, err := h.db.GetMessageRevisions(messageID)
+    if err != nil {
+        log.Printf("Error getting revisions: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if revisions == nil {
+        revisions = []*models.MessageRevision{}
+    }
+    writeJSON(w, http.StatusOK, revisions)
+}
+
+// writeMessageError maps message operation errors to HTTP responses
+func writeMessageError(w http.ResponseWriter, err error) {
+    var rejected *rejection
+    if errors.As(err, &rejected) {
+        http.Error(w, rejected.reason, http.StatusBadRequest)
+        return
+    }
+
+    switch err {
+    case errMessageNotFound:
+        http.Error(w, "Message not found", http.StatusNotFound)
+    case errNotSender, errSystemMessage:
+        http.Error(w, err.Error(), http.StatusForbidden)
+    case errEditWindowClosed:
+        http.Error(w, err.Error(), http.StatusConflict)
+    case errEmptyContent, errInvalidScope:
+        http.Error(w, err.Error(), http.StatusBadRequest)
+    default:
+        log.Printf("Error updating message: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+    }
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"quantum-chat/internal/encryption"
+	"quantum-chat/internal/models"
+)
+
+type e2eRequiredRequest struct {
+    E2ERequired *bool `json:"e2e_required"`
+}
+
+// checkContent refuses chat content that is not a well-formed envelope for
+// a supported suite, so plaintext never reaches the database. conv may be nil
+// for messages outside any conversation.
+func checkContent(conv *models.Conversation, content json.RawMessage) error {
+    if _, err := encryption.ParseEnvelope(content); err != nil {
+        if conv != nil && conv.E2ERequired {
+            return reject("This conversation requires encrypted messages: " + err.Error())
+        }
+        return reject("Message content must be an encrypted envelope: " + err.Error())
+    }
+    return nil
+}
+
+// handleE2ERequired serves PUT /api/conversations/{id}/e2e. Like the message
+// TTL, any member of a direct conversation may change it; in groups only
+// admins may. Members are told when the requirement changes so their clients
+// stop sending plaintext reactions.
+func (h *Handlers) handleE2ERequired(w http.ResponseWriter, r *http.Request, conv *models.Conversation, userID int64) {
+    if conv.IsGroup && memberRole(conv, userID) != models.RoleAdmin {
+        http.Error(w, "Only group admins can manage the group", http.StatusForbidden)
+        return
+    }
+
+    var req e2eRequiredRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.E2ERequired == nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+
+    if err := h.db.SetE2ERequired(conv.ID, *req.E2ERequired); err != nil {
+        log.Printf("Error setting E2E requirement: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    changed := conv.E2ERequired != *req.E2ERequired
+    conv.E2ERequired = *req.E2ERequired
+    if changed {
+        h.notifyConversationUpdated(conv)
+    }
+    writeJSON(w, http.StatusOK, conv)
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"quantum-chat/internal/models"
+	"quantum-chat/internal/repository"
+)
+
+// Disappearing message limits
+const (
+    // Longest lifetime a conversation or message may ask for, in seconds
+    maxMessageTTL = 28 * 24 * 60 * 60
+
+    // Number of expired messages deleted per reaper query
+    reaperBatchSize = 500
+)
+
+var errInvalidTTL = errors.New("message_ttl must be between 0 and 2419200 seconds")
+
+// Clock tells the time. Expiry goes through it so it can be driven by a fake
+// clock instead of waiting for real time to pass.
+type Clock interface {
+    Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// isExpired reports whether a message is past its expiry by the clock. Such
+// messages are gone for everyone even before the reaper deletes them.
+func (h *Handlers) isExpired(msg *models.Message) bool {
+    return msg.ExpiresAt != nil && !msg.ExpiresAt.After(h.clock.Now())
+}
+
+// expiryStore is the part of the database the reaper uses
+type expiryStore interface {
+    DeleteExpiredMessages(now time.Time, limit int) ([]*repository.ExpiredMessage, error)
+}
+
+type messageTTLRequest struct {
+    MessageTTL int `json:"message_ttl"`
+}
+
+func validTTL(ttl int) bool {
+    return ttl >= 0 && ttl <= maxMessageTTL
+}
+
+// messageExpiry returns when a message sent now to conv disappears, or nil.
+// A message may ask for a shorter lifetime than its conversation, never for
+// a longer one.
+func (h *Handlers) messageExpiry(conv *models.Conversation, ttl int) *time.Time {
+    if conv.MessageTTL > 0 && (ttl == 0 || ttl > conv.MessageTTL) {
+        ttl = conv.MessageTTL
+    }
+    if ttl == 0 {
+        return nil
+    }
+    expiresAt := h.clock.Now().Add(time.Duration(ttl) * time.Second)
+    return &expiresAt
+}
+
+// RunReaper deletes expired messages, and then attachments nothing refers to
+// any more, every interval until stop is closed. Expiry times live in the
+// database, so the first pass right after start catches up on everything
+// that expired while the server was down.
+func (h *Handlers) RunReaper(interval time.Duration, stop <-chan struct{}) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        if n, err := h.reapExpired(h.db); err != nil {
+            log.Printf("Reaper: Error deleting expired messages: %v", err)
+        } else if n > 0 {
+            log.Printf("Reaper: Deleted %d expired messages", n)
+        }
+        if n, err := h.collectAttachments(); err != nil {
+            log.Printf("Reaper: Error deleting orphaned attachments: %v", err)
+        } else if n > 0 {
+            log.Printf("Reaper: Deleted %d orphaned attachments", n)
+        }
+
+        select {
+        case <-ticker.C:
+        case <-stop:
+            return
+        }
+    }
+}
+
+// reapExpired deletes every message expired by the clock's current time and
+// tells the participants' connected devices to purge their copies
+func (h *Handlers) reapExpired(store expiryStore) (int, error) {
+    now := h.clock.Now()
+    total := 0
+    for {
+        expired, err := store.DeleteExpiredMessages(now, reaperBatchSize)
+        if err != nil {
+            return total, err
+        }
+
+        for _, msg := range expired {
+            frame, _ := json.Marshal(WSMessage{
+                Type:           MessageTypeExpired,
+                ConversationID: msg.ConversationID,
+                Timestamp:      now.Unix(),
+                MessageID:      msg.ID,
+            })
+            h.hub.fanout(append(msg.RecipientIDs, msg.SenderID), frame)
+        }
+        total += len(expired)
+
+        if len(expired) < reaperBatchSize {
+            return total, nil
+        }
+    }
+}
+
+// handleMessageTTL serves PUT /api/conversations/{id}/ttl. Any member of a
+// direct conversation may change it; in groups only admins may.
+func (h *Handlers) handleMessageTTL(w http.ResponseWriter, r *http.Request, conv *models.Conversation, userID int64) {
+    if conv.IsGroup && memberRole(conv, userID) != models.RoleAdmin {
+        http.Error(w, "Only group admins can manage the group", http.StatusForbidden)
+        return
+    }
+
+    var req messageTTLRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+    if !validTTL(req.MessageTTL) {
+        http.Error(w, errInvalidTTL.Error(), http.StatusBadRequest)
+        return
+    }
+
+    if err := h.db.SetMessageTTL(conv.ID, req.MessageTTL); err != nil {
+        log.Printf("Error setting message TTL: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    conv.MessageTTL = req.MessageTTL
+    writeJSON(w, http.StatusOK, conv)
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"quantum-chat/internal/models"
+	"quantum-chat/internal/repository"
+)
+
+// fakeClock only moves when the test advances it
+type fakeClock struct {
+    mutex sync.Mutex
+    now   time.Time
+}
+
+func newFakeClock() *fakeClock {
+    return &fakeClock{now: time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+    return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+    c.now = c.now.Add(d)
+}
+
+// fakeExpiryStore keeps messages with their expiry in memory and deletes
+// them like DeleteExpiredMessages does
+type fakeExpiryStore struct {
+    messages  []*fakeExpiringMessage
+    callTimes []time.Time
+}
+
+type fakeExpiringMessage struct {
+    repository.ExpiredMessage
+    expiresAt time.Time
+}
+
+func (s *fakeExpiryStore) add(id, senderID int64, recipientIDs []int64, expiresAt time.Time) {
+    s.messages = append(s.messages, &fakeExpiringMessage{
+        ExpiredMessage: repository.ExpiredMessage{ID: id, ConversationID: 1, SenderID: senderID, RecipientIDs: recipientIDs},
+        expiresAt:      expiresAt,
+    })
+}
+
+func (s *fakeExpiryStore) DeleteExpiredMessages(now time.Time, limit int) ([]*repository.ExpiredMessage, error) {
+    s.callTimes = append(s.callTimes, now)
+
+    var expired []*repository.ExpiredMessage
+    var kept []*fakeExpiringMessage
+    for _, msg := range s.messages {
+        if len(expired) < limit && !msg.expiresAt.After(now) {
+            expired = append(expired, &msg.ExpiredMessage)
+        } else {
+            kept = append(kept, msg)
+        }
+    }
+    s.messages = kept
+    return expired, nil
+}
+
+// newTestHandlers returns handlers on the clock with a hub that is not
+// running, so frames stay in the clients' send buffers
+func newTestHandlers(clock Clock) *Handlers {
+    h := &Handlers{
+        clock:            clock,
+        prekeyClaims:     newRateLimiter(prekeyClaimLimit, prekeyClaimWindow),
+        sealedDeliveries: newRateLimiter(sealedDeliveryLimit, sealedDeliveryWindow),
+    }
+    h.hub = NewHub(h)
+    return h
+}
+
+// connect registers a device for userID directly with the hub
+func connect(h *Handlers, userID int64) *Client {
+    client := &Client{
+        UserID:   userID,
+        DeviceID: "test",
+        Send:     make(chan []byte, 1024),
+        hub:      h.hub,
+        done:     make(chan struct{}),
+    }
+    h.hub.clients[userID] = map[string]*Client{client.DeviceID: client}
+    return client
+}
+
+// received drains the frames queued for a client
+func received(t *testing.T, client *Client) []WSMessage {
+    t.Helper()
+    var frames []WSMessage
+    for {
+        select {
+        case raw := <-client.Send:
+            var frame WSMessage
+            if err := json.Unmarshal(raw, &frame); err != nil {
+                t.Fatalf("invalid frame %s: %v", raw, err)
+            }
+            frames = append(frames, frame)
+        default:
+            return frames
+        }
+    }
+}
+
+func TestMessageExpiry(t *testing.T) {
+    clock := newFakeClock()
+    h := newTestHandlers(clock)
+
+    tests := []struct {
+        name    string
+        convTTL int
+        msgTTL  int
+        want    time.Duration // 0 means the message never expires
+    }{
+        {"no ttl", 0, 0, 0},
+        {"message ttl", 0, 60, time.Minute},
+        {"conversation ttl", 3600, 0, time.Hour},
+        {"shorter message ttl", 3600, 60, time.Minute},
+        {"longer message ttl is capped", 60, 3600, time.Minute},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := h.messageExpiry(&models.Conversation{MessageTTL: tt.convTTL}, tt.msgTTL)
+            if tt.want == 0 {
+                if got != nil {
+                    t.Fatalf("expiry = %v, want none", got)
+                }
+                return
+            }
+            if got == nil || !got.Equal(clock.Now().Add(tt.want)) {
+                t.Fatalf("expiry = %v, want %v", got, clock.Now().Add(tt.want))
+            }
+        })
+    }
+
+    // Expiry follows the clock, not the wall time
+    clock.Advance(48 * time.Hour)
+    got := h.messageExpiry(&models.Conversation{}, 60)
+    if want := clock.Now().Add(time.Minute); got == nil || !got.Equal(want) {
+        t.Fatalf("expiry after advancing = %v, want %v", got, want)
+    }
+}
+
+func TestReapExpired(t *testing.T) {
+    clock := newFakeClock()
+    h := newTestHandlers(clock)
+    sender := connect(h, 1)
+    recipient := connect(h, 2)
+    bystander := connect(h, 3)
+
+    store := &fakeExpiryStore{}
+    store.add(10, 1, []int64{2}, clock.Now().Add(time.Minute))
+    store.add(11, 1, []int64{2}, clock.Now().Add(time.Hour))
+
+    n, err := h.reapExpired(store)
+    if err != nil || n != 0 {
+        t.Fatalf("reap before expiry = %d, %v; want 0", n, err)
+    }
+    if frames := received(t, recipient); len(frames) != 0 {
+        t.Fatalf("recipient got %d frames before expiry", len(frames))
+    }
+
+    // At the expiry the message goes, and only then
+    clock.Advance(time.Minute)
+    n, err = h.reapExpired(store)
+    if err != nil || n != 1 {
+        t.Fatalf("reap at expiry = %d, %v; want 1", n, err)
+    }
+    if got := store.callTimes[len(store.callTimes)-1]; !got.Equal(clock.Now()) {
+        t.Fatalf("store queried at %v, want the clock's %v", got, clock.Now())
+    }
+    for _, client := range []*Client{sender, recipient} {
+        frames := received(t, client)
+        if len(frames) != 1 {
+            t.Fatalf("user %d got %d frames, want 1", client.UserID, len(frames))
+        }
+        frame := frames[0]
+        if frame.Type != MessageTypeExpired || frame.MessageID != 10 || frame.Timestamp != clock.Now().Unix() {
+            t.Fatalf("user %d got %+v, want expired frame for message 10", client.UserID, frame)
+        }
+    }
+    if frames := received(t, bystander); len(frames) != 0 {
+        t.Fatalf("bystander got %d frames", len(frames))
+    }
+
+    clock.Advance(time.Hour)
+    n, err = h.reapExpired(store)
+    if err != nil || n != 1 {
+        t.Fatalf("reap of second message = %d, %v; want 1", n, err)
+    }
+    if len(store.messages) != 0 {
+        t.Fatalf("%d messages left after reaping", len(store.messages))
+    }
+}
+
+func TestReapExpiredBatches(t *testing.T) {
+    clock := newFakeClock()
+    h := newTestHandlers(clock)
+
+    store := &fakeExpiryStore{}
+    for i := 0; i < reaperBatchSize+1; i++ {
+        store.add(int64(i+1), 1, []int64{2}, clock.Now())
+    }
+
+    n, err := h.reapExpired(store)
+    if err != nil || n != reaperBatchSize+1 {
+        t.Fatalf("reap = %d, %v; want %d", n, err, reaperBatchSize+1)
+    }
+    if len(store.callTimes) != 2 {
+        t.Fatalf("store queried %d times, want 2", len(store.callTimes))
+    }
+}
+
+func TestIsExpired(t *testing.T) {
+    clock := newFakeClock()
+    h := newTestHandlers(clock)
+
+    expiresAt := clock.Now().Add(time.Minute)
+    msg := &models.Message{ExpiresAt: &expiresAt}
+    if h.isExpired(msg) {
+        t.Fatal("message expired before its expiry")
+    }
+    if h.isExpired(&models.Message{}) {
+        t.Fatal("message without expiry expired")
+    }
+
+    // Reactions, replies and threads go by the clock, not the reaper
+    clock.Advance(time.Minute)
+    if !h.isExpired(msg) {
+        t.Fatal("message not expired at its expiry")
+    }
+}
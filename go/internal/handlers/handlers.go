@@ -1,26 +1,45 @@
 package handlers
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+
+	"quantum-chat/internal/blobstore"
 	"quantum-chat/internal/config"
 	"quantum-chat/internal/middleware"
 	"quantum-chat/internal/repository"
+	"quantum-chat/internal/transparency"
 )
 
 type Handlers struct {
-    db     *repository.Database
-    config *config.Config
-    hub    *Hub
+    db               *repository.Database
+    config           *config.Config
+    hub              *Hub
+    members          *memberCache
+    clock            Clock
+    blobs            blobstore.Store
+    keyLog           *keyLog
+    prekeyClaims     *rateLimiter
+    sealedDeliveries *rateLimiter
 }
 
-func NewHandlers(db *repository.Database, config *config.Config) *Handlers {
+func NewHandlers(db *repository.Database, config *config.Config, blobs blobstore.Store, logSigner *transparency.Signer) *Handlers {
     h := &Handlers{
-        db:     db,
-        config: config,
+        db:               db,
+        config:           config,
+        blobs:            blobs,
+        keyLog:           newKeyLog(logSigner),
+        members:          newMemberCache(db),
+        clock:            systemClock{},
+        prekeyClaims:     newRateLimiter(prekeyClaimLimit, prekeyClaimWindow),
+        sealedDeliveries: newRateLimiter(sealedDeliveryLimit, sealedDeliveryWindow),
     }
     h.hub = NewHub(h)
     go h.hub.Run()
+    go h.runPresence()
     return h
 }
 
@@ -50,8 +69,31 @@ func (h *Handlers) SetupRoutes(mux *http.ServeMux) {
     mux.HandleFunc("/api/auth/login", withLogging(h.handleLogin))
     mux.HandleFunc("/api/auth/refresh", withLogging(h.handleRefreshToken))
 
+    // Sealed sender messages are authorized by the receiver's delivery
+    // token instead of a JWT
+    mux.HandleFunc("/api/sealed/messages", withLogging(h.handleSealedMessage))
+
     // Protected routes (auth required)
     mux.HandleFunc("/api/auth/logout", withAuthAndLogging(h.handleLogout))
+    mux.HandleFunc("/api/conversations", withAuthAndLogging(h.handleConversations))
+    mux.HandleFunc("/api/conversations/", withAuthAndLogging(h.handleConversation))
+    mux.HandleFunc("/api/messages", withAuthAndLogging(h.handleMessages))
+    mux.HandleFunc("/api/messages/read", withAuthAndLogging(h.handleMarkRead))
+    mux.HandleFunc("/api/messages/", withAuthAndLogging(h.handleMessage))
+    mux.HandleFunc("/api/announcements", withAuthAndLogging(h.handleAnnouncements))
+    mux.HandleFunc("/api/attachments/", withAuthAndLogging(h.handleAttachments))
+    mux.HandleFunc("/api/scheduled", withAuthAndLogging(h.handleScheduledMessages))
+    mux.HandleFunc("/api/scheduled/", withAuthAndLogging(h.handleScheduledMessage))
+    mux.HandleFunc("/api/users/", withAuthAndLogging(h.handleUser))
+    mux.HandleFunc("/api/settings/privacy", withAuthAndLogging(h.handlePrivacySettings))
+    mux.HandleFunc("/api/contacts", withAuthAndLogging(h.handleContacts))
+    mux.HandleFunc("/api/contacts/", withAuthAndLogging(h.handleContact))
+    mux.HandleFunc("/api/blocks", withAuthAndLogging(h.handleBlocks))
+    mux.HandleFunc("/api/blocks/", withAuthAndLogging(h.handleBlock))
+    mux.HandleFunc("/api/devices/", withAuthAndLogging(h.handleDevice))
+    mux.HandleFunc("/api/keys/rotate", withAuthAndLogging(h.handleKeyRotation))
+    mux.HandleFunc("/api/sealed/token", withAuthAndLogging(h.handleDeliveryToken))
+    mux.HandleFunc("/api/transparency/", withAuthAndLogging(h.handleTransparency))
     
     // WebSocket route (auth required)
     mux.HandleFunc("/ws", withAuthAndLogging(h.handleWebSocket))
@@ -60,4 +102,28 @@ func (h *Handlers) SetupRoutes(mux *http.ServeMux) {
 func (h *Handlers) handleHealth(w http.ResponseWriter, r *http.Request) {
     w.WriteHeader(http.StatusOK)
     w.Write([]byte("OK"))
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(v)
+}
+
+// pathSegments splits the part of path after prefix into its segments
+func pathSegments(path, prefix string) []string {
+    rest := strings.Trim(strings.TrimPrefix(path, prefix), "/")
+    if rest == "" {
+        return nil
+    }
+    return strings.Split(rest, "/")
+}
+
+func parseID(s string) (int64, error) {
+    id, err := strconv.ParseInt(s, 10, 64)
+    if err != nil || id <= 0 {
+        return 0, strconv.ErrSyntax
+    }
+    return id, nil
 }
\ No newline at end of file
@@ -3,26 +3,42 @@ package handlers
 import (
 	"log"
 	"sync"
+	"time"
 )
 
+// broadcastMessage is a frame for every connected client, or only for the
+// users in audience if it is set
+type broadcastMessage struct {
+    frame    []byte
+    audience map[int64]bool
+}
+
 type Hub struct {
-    clients    map[int64]*Client
-    broadcast  chan []byte
+    // clients holds every connection of a user, keyed by device ID
+    clients    map[int64]map[string]*Client
+    broadcast  chan *broadcastMessage
     register   chan *Client
     unregister chan *Client
     mutex      sync.RWMutex
     handlers   *Handlers
+    typing     *typingTracker
+
+    // presence receives a user's first connect and last disconnect
+    presence chan presenceEvent
 }
 
 func NewHub(handlers *Handlers) *Hub {
-    return &Hub{
-        clients:    make(map[int64]*Client),
-        broadcast:  make(chan []byte),
+    h := &Hub{
+        clients:    make(map[int64]map[string]*Client),
+        broadcast:  make(chan *broadcastMessage, broadcastQueueSize),
         register:   make(chan *Client),
         unregister: make(chan *Client),
         mutex:      sync.RWMutex{},
         handlers:   handlers,
+        presence:   make(chan presenceEvent, 256),
     }
+    h.typing = newTypingTracker(h)
+    return h
 }
 
 func (h *Hub) Run() {
@@ -30,31 +46,156 @@ func (h *Hub) Run() {
         select {
         case client := <-h.register:
             h.mutex.Lock()
-            h.clients[client.UserID] = client
+            devices, online := h.clients[client.UserID]
+            if !online {
+                devices = make(map[string]*Client)
+                h.clients[client.UserID] = devices
+            }
+            // A reconnecting device replaces its previous connection
+            if previous, ok := devices[client.DeviceID]; ok {
+                previous.close()
+                previous.Conn.Close()
+                log.Printf("Hub: Replaced connection: %d/%s", client.UserID, client.DeviceID)
+            }
+            devices[client.DeviceID] = client
             h.mutex.Unlock()
-            log.Printf("Hub: Client registered: %d", client.UserID)
+            log.Printf("Hub: Client registered: %d/%s", client.UserID, client.DeviceID)
+            if !online {
+                h.presence <- presenceEvent{userID: client.UserID, online: true, at: time.Now()}
+            }
             
         case client := <-h.unregister:
             h.mutex.Lock()
-            if _, ok := h.clients[client.UserID]; ok {
-                delete(h.clients, client.UserID)
-                close(client.Send)
-                log.Printf("Hub: Client unregistered: %d", client.UserID)
-            }
+            offline := h.removeClient(client)
             h.mutex.Unlock()
+            client.close()
+            if offline {
+                h.presence <- presenceEvent{userID: client.UserID, online: false, at: time.Now()}
+            }
             
         case message := <-h.broadcast:
-            h.mutex.RLock()
-            for _, client := range h.clients {
-                select {
-                case client.Send <- message:
-                default:
-                    close(client.Send)
-                    delete(h.clients, client.UserID)
-                    log.Printf("Hub: Client removed due to blocked channel: %d", client.UserID)
+            var offline []int64
+            h.mutex.Lock()
+            for userID, devices := range h.clients {
+                if message.audience != nil && !message.audience[userID] {
+                    continue
                 }
+                for _, client := range devices {
+                    select {
+                    case client.Send <- message.frame:
+                    default:
+                        client.close()
+                        if h.removeClient(client) {
+                            offline = append(offline, client.UserID)
+                        }
+                        log.Printf("Hub: Client removed due to blocked channel: %d/%s", client.UserID, client.DeviceID)
+                    }
+                }
+            }
+            h.mutex.Unlock()
+            for _, userID := range offline {
+                h.presence <- presenceEvent{userID: userID, online: false, at: time.Now()}
             }
-            h.mutex.RUnlock()
         }
     }
-}
\ No newline at end of file
+}
+
+// removeClient drops the connection if it is still the registered one for
+// its device and reports whether that was the user's last connection. The
+// caller must hold the write lock.
+func (h *Hub) removeClient(client *Client) bool {
+    devices, ok := h.clients[client.UserID]
+    if !ok || devices[client.DeviceID] != client {
+        return false
+    }
+    delete(devices, client.DeviceID)
+    log.Printf("Hub: Client unregistered: %d/%s", client.UserID, client.DeviceID)
+    if len(devices) == 0 {
+        delete(h.clients, client.UserID)
+        return true
+    }
+    return false
+}
+
+// isOnline reports whether the user has at least one connected device
+func (h *Hub) isOnline(userID int64) bool {
+    h.mutex.RLock()
+    defer h.mutex.RUnlock()
+    return len(h.clients[userID]) > 0
+}
+
+// sendToUser delivers a frame to every connected device of the user
+func (h *Hub) sendToUser(userID int64, message []byte) bool {
+    return h.sendToDevices(userID, nil, message)
+}
+
+// sendToOtherDevices delivers a frame to every device of the client's user
+// except the client itself, keeping the sender's devices in sync
+func (h *Hub) sendToOtherDevices(client *Client, message []byte) bool {
+    return h.sendToDevices(client.UserID, client, message)
+}
+
+func (h *Hub) sendToDevices(userID int64, except *Client, message []byte) bool {
+    h.mutex.RLock()
+    defer h.mutex.RUnlock()
+
+    delivered := false
+    for _, client := range h.clients[userID] {
+        if client == except {
+            continue
+        }
+        select {
+        case client.Send <- message:
+            delivered = true
+        default:
+            log.Printf("Hub: Dropping message for client %d/%s, send buffer full", userID, client.DeviceID)
+        }
+    }
+    return delivered
+}
+
+// sendToDevice delivers a frame to one device of the user, if connected
+func (h *Hub) sendToDevice(userID int64, deviceID string, message []byte) bool {
+    h.mutex.RLock()
+    defer h.mutex.RUnlock()
+
+    client, ok := h.clients[userID][deviceID]
+    if !ok {
+        return false
+    }
+    select {
+    case client.Send <- message:
+        return true
+    default:
+        log.Printf("Hub: Dropping message for client %d/%s, send buffer full", userID, deviceID)
+        return false
+    }
+}
+
+// queueBroadcast hands a broadcast to the hub loop without waiting for it.
+// Broadcast frames are stored messages, so if the queue is full they are
+// dropped like any frame for a full send buffer and replayed on reconnect.
+func (h *Hub) queueBroadcast(message *broadcastMessage) {
+    select {
+    case h.broadcast <- message:
+    default:
+        log.Printf("Hub: Dropping broadcast, queue full")
+    }
+}
+
+// fanout delivers a frame to every online user in userIDs
+func (h *Hub) fanout(userIDs []int64, message []byte) {
+    for _, userID := range userIDs {
+        h.sendToUser(userID, message)
+    }
+}
+
+// disconnectUser closes every connection of the user
+func (h *Hub) disconnectUser(userID int64) {
+    h.mutex.RLock()
+    defer h.mutex.RUnlock()
+
+    for _, client := range h.clients[userID] {
+        client.Conn.Close()
+    }
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"quantum-chat/internal/encryption"
+	"quantum-chat/internal/middleware"
+	"quantum-chat/internal/models"
+)
+
+type rotateKeyRequest struct {
+    PublicKey []byte `json:"public_key"`
+}
+
+// keyChangedEvent is the content of the system message sent when a user's
+// key changes; clients show it as a safety number change
+type keyChangedEvent struct {
+    Event    string `json:"event"`
+    UserID   int64  `json:"user_id"`
+    KeyID    int64  `json:"key_id"`
+    LogIndex *int64 `json:"log_index,omitempty"`
+}
+
+const eventKeyChanged = "key_changed"
+
+// handleKeyRotation serves POST /api/keys/rotate. The new key becomes
+// current, the old one stays in the user's key history and everyone who may
+// hold the old key is told.
+func (h *Handlers) handleKeyRotation(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    userID, ok := middleware.GetUserIDFromContext(r.Context())
+    if !ok {
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    var req rotateKeyRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+    if _, err := encryption.ParsePublicKey(req.PublicKey); err != nil {
+        http.Error(w, "public key is not a supported key: "+err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    user, err := h.db.GetUserByID(userID)
+    if err != nil || user == nil {
+        log.Printf("Error getting user: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if bytes.Equal(user.PublicKey, req.PublicKey) {
+        http.Error(w, "public key is already current", http.StatusConflict)
+        return
+    }
+
+    key, err := h.db.RotateUserKey(userID, req.PublicKey)
+    if err != nil {
+        log.Printf("Error rotating key: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+
+    if err := h.announceKeyChange(key); err != nil {
+        log.Printf("Error announcing key change of %d: %v", userID, err)
+    }
+    writeJSON(w, http.StatusOK, key)
+}
+
+// announceKeyChange sends a system message to the user's contacts and to
+// everyone sharing a conversation with them, since all of them may have
+// encrypted to the old key. It is stored so offline recipients get it on
+// their next connect; the user's own devices get a copy.
+func (h *Handlers) announceKeyChange(key *models.UserKey) error {
+    contacts, err := h.db.GetContactIDs(key.UserID)
+    if err != nil {
+        return err
+    }
+    peers, err := h.db.GetConversationPeerIDs(key.UserID)
+    if err != nil {
+        return err
+    }
+    recipientIDs := uniqueIDs(append(contacts, peers...), key.UserID)
+
+    content, _ := json.Marshal(keyChangedEvent{
+        Event:    eventKeyChanged,
+        UserID:   key.UserID,
+        KeyID:    key.ID,
+        LogIndex: key.LogIndex,
+    })
+    msg := &models.Message{
+        Content:   content,
+        Timestamp: time.Now().Unix(),
+    }
+    if len(recipientIDs) > 0 {
+        if err := h.db.SaveSystemMessage(msg, recipientIDs); err != nil {
+            return err
+        }
+    } else {
+        msg.Type = models.MessageTypeSystem
+    }
+
+    audience := map[int64]bool{key.UserID: true}
+    for _, id := range recipientIDs {
+        audience[id] = true
+    }
+    h.hub.queueBroadcast(&broadcastMessage{frame: chatFrame(msg), audience: audience})
+    return nil
+}
+
+// serveUserKeys serves GET /api/users/{id}/keys: the user's key history,
+// newest first, or with ?at= (Unix seconds) the key current at that time
+func (h *Handlers) serveUserKeys(w http.ResponseWriter, r *http.Request, targetID int64) {
+    if r.URL.Query().Get("at") != "" {
+        at, ok := queryUint(w, r, "at", 0)
+        if !ok {
+            return
+        }
+        key, err := h.db.GetUserKeyAt(targetID, time.Unix(int64(at), 0))
+        if err != nil {
+            log.Printf("Error getting user key: %v", err)
+            http.Error(w, "Internal server error", http.StatusInternalServerError)
+            return
+        }
+        if key == nil {
+            http.Error(w, "No key at that time", http.StatusNotFound)
+            return
+        }
+        writeJSON(w, http.StatusOK, key)
+        return
+    }
+
+    keys, err := h.db.GetUserKeys(targetID)
+    if err != nil {
+        log.Printf("Error getting user keys: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if keys == nil {
+        keys = []*models.UserKey{}
+    }
+    writeJSON(w, http.StatusOK, keys)
+}
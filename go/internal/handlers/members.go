@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"quantum-chat/internal/repository"
+)
+
+// How long a conversation's member list is served from memory
+const memberCacheTTL = 30 * time.Second
+
+// memberCache keeps recently used conversation member lists in memory, so
+// high-frequency ephemeral events do not hit the database for every frame
+type memberCache struct {
+    db      *repository.Database
+    mu      sync.Mutex
+    entries map[int64]memberCacheEntry
+}
+
+type memberCacheEntry struct {
+    members []int64
+    expires time.Time
+}
+
+func newMemberCache(db *repository.Database) *memberCache {
+    return &memberCache{
+        db:      db,
+        entries: make(map[int64]memberCacheEntry),
+    }
+}
+
+// members returns the user IDs of the conversation's members
+func (mc *memberCache) members(convID int64) ([]int64, error) {
+    mc.mu.Lock()
+    entry, ok := mc.entries[convID]
+    mc.mu.Unlock()
+    if ok && time.Now().Before(entry.expires) {
+        return entry.members, nil
+    }
+
+    members, err := mc.db.GetConversationMemberIDs(convID)
+    if err != nil {
+        return nil, err
+    }
+
+    // Empty results are not cached: the conversation may be created next
+    if len(members) > 0 {
+        mc.mu.Lock()
+        mc.entries[convID] = memberCacheEntry{members: members, expires: time.Now().Add(memberCacheTTL)}
+        mc.mu.Unlock()
+    }
+    return members, nil
+}
+
+// invalidate drops the cached member list after a membership change
+func (mc *memberCache) invalidate(convID int64) {
+    mc.mu.Lock()
+    delete(mc.entries, convID)
+    mc.mu.Unlock()
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"quantum-chat/internal/middleware"
+	"quantum-chat/internal/models"
+	"quantum-chat/internal/repository"
+)
+
+// History page sizes
+const (
+    defaultHistoryLimit = 50
+    maxHistoryLimit     = 100
+)
+
+type historyResponse struct {
+    Messages []*models.Message `json:"messages"`
+    HasMore  bool              `json:"has_more"`
+}
+
+// handleMessages serves GET /api/messages with optional peer_id and
+// conversation_id filters
+func (h *Handlers) handleMessages(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    userID, ok := middleware.GetUserIDFromContext(r.Context())
+    if !ok {
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    q := repository.MessageQuery{UserID: userID}
+    var err error
+    if q.PeerID, err = queryID(r, "peer_id"); err != nil {
+        http.Error(w, "Invalid peer_id", http.StatusBadRequest)
+        return
+    }
+    if q.ConversationID, err = queryID(r, "conversation_id"); err != nil {
+        http.Error(w, "Invalid conversation_id", http.StatusBadRequest)
+        return
+    }
+
+    h.serveHistory(w, r, q)
+}
+
+// handleMessage serves /api/messages/{id}/... resources
+func (h *Handlers) handleMessage(w http.ResponseWriter, r *http.Request) {
+    userID, ok := middleware.GetUserIDFromContext(r.Context())
+    if !ok {
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    parts := pathSegments(r.URL.Path, "/api/messages/")
+    if len(parts) == 0 || len(parts) > 2 {
+        http.NotFound(w, r)
+        return
+    }
+    messageID, err := parseID(parts[0])
+    if err != nil {
+        http.Error(w, "Invalid message ID", http.StatusBadRequest)
+        return
+    }
+
+    if len(parts) == 1 {
+        switch r.Method {
+        case http.MethodPut, http.MethodPatch:
+            h.handleEditMessageREST(w, r, userID, messageID)
+        case http.MethodDelete:
+            h.handleDeleteMessageREST(w, r, userID, messageID)
+        default:
+            http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        }
+        return
+    }
+
+    switch parts[1] {
+    case "receipts":
+        h.handleMessageReceipts(w, r, userID, messageID)
+    case "revisions":
+        h.handleMessageRevisions(w, r, userID, messageID)
+    default:
+        http.NotFound(w, r)
+    }
+}
+
+// serveHistory applies the before/after/limit parameters to q and writes one
+// page of history
+func (h *Handlers) serveHistory(w http.ResponseWriter, r *http.Request, q repository.MessageQuery) {
+    var err error
+    if q.BeforeID, err = queryID(r, "before"); err != nil {
+        http.Error(w, "Invalid before cursor", http.StatusBadRequest)
+        return
+    }
+    if q.AfterID, err = queryID(r, "after"); err != nil {
+        http.Error(w, "Invalid after cursor", http.StatusBadRequest)
+        return
+    }
+
+    limit := defaultHistoryLimit
+    if raw := r.URL.Query().Get("limit"); raw != "" {
+        limit, err = strconv.Atoi(raw)
+        if err != nil || limit <= 0 {
+            http.Error(w, "Invalid limit", http.StatusBadRequest)
+            return
+        }
+        if limit > maxHistoryLimit {
+            limit = maxHistoryLimit
+        }
+    }
+
+    // Fetch one extra row to find out whether another page exists
+    q.Limit = limit + 1
+    q.Now = h.clock.Now()
+    messages, err := h.db.GetMessages(q)
+    if err != nil {
+        log.Printf("Error getting messages: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+
+    resp := historyResponse{Messages: messages}
+    if len(messages) > limit {
+        resp.HasMore = true
+        if q.AfterID != 0 && q.BeforeID == 0 {
+            resp.Messages = messages[:limit]
+        } else {
+            resp.Messages = messages[1:]
+        }
+    }
+    if resp.Messages == nil {
+        resp.Messages = []*models.Message{}
+    }
+
+    if err := h.attachReactions(resp.Messages); err != nil {
+        log.Printf("Error getting reactions: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+// attachReactions fills in the reaction summaries of a page of messages
+func (h *Handlers) attachReactions(messages []*models.Message) error {
+    if len(messages) == 0 {
+        return nil
+    }
+
+    ids := make([]int64, len(messages))
+    for i, msg := range messages {
+        ids[i] = msg.ID
+    }
+    summaries, err := h.db.GetReactionSummaries(ids)
+    if err != nil {
+        return err
+    }
+    for _, msg := range messages {
+        msg.Reactions = summaries[msg.ID]
+    }
+    return nil
+}
+
+// queryID parses an optional positive ID query parameter
+func queryID(r *http.Request, name string) (int64, error) {
+    raw := r.URL.Query().Get(name)
+    if raw == "" {
+        return 0, nil
+    }
+    return parseID(raw)
+}
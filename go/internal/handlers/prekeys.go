@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"quantum-chat/internal/encryption"
+	"quantum-chat/internal/middleware"
+	"quantum-chat/internal/models"
+	"quantum-chat/internal/repository"
+)
+
+const (
+    // Most one-time prekeys of one kind a device may upload at once
+    maxPrekeyBatch = 100
+
+    // Most unused one-time prekeys of one kind a device may hold
+    maxPrekeyStock = 1000
+
+    // Devices are warned once they have fewer one-time prekeys of a kind
+    prekeyLowWatermark = 10
+
+    // Bundle claims a user may make per window. Every claim uses up
+    // one-time prekeys of other users, so this keeps anyone from draining them.
+    prekeyClaimLimit  = 30
+    prekeyClaimWindow = time.Minute
+)
+
+type deviceKeysRequest struct {
+    IdentityKey  []byte        `json:"identity_key"`
+    SignedPrekey models.Prekey `json:"signed_prekey"`
+}
+
+type prekeysRequest struct {
+    PQPrekeys        []models.Prekey `json:"pq_prekeys"`
+    ClassicalPrekeys []models.Prekey `json:"classical_prekeys"`
+}
+
+type deviceKeysResponse struct {
+    *models.DeviceKeys
+    Prekeys *models.PrekeyCounts `json:"prekeys"`
+}
+
+type prekeyBundlesResponse struct {
+    UserID  int64                  `json:"user_id"`
+    Devices []*models.PrekeyBundle `json:"devices"`
+}
+
+// prekeysLowEvent tells a device to upload more one-time prekeys
+type prekeysLowEvent struct {
+    DeviceID string `json:"device_id"`
+    *models.PrekeyCounts
+}
+
+// handleDevice serves /api/devices/{device_id}/keys and
+// /api/devices/{device_id}/prekeys for the caller's own devices
+func (h *Handlers) handleDevice(w http.ResponseWriter, r *http.Request) {
+    userID, ok := middleware.GetUserIDFromContext(r.Context())
+    if !ok {
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    parts := pathSegments(r.URL.Path, "/api/devices/")
+    if len(parts) != 2 {
+        http.NotFound(w, r)
+        return
+    }
+    deviceID := parts[0]
+    if !deviceIDPattern.MatchString(deviceID) {
+        http.Error(w, "Invalid device ID", http.StatusBadRequest)
+        return
+    }
+
+    switch parts[1] {
+    case "keys":
+        switch r.Method {
+        case http.MethodGet:
+            h.getDeviceKeys(w, userID, deviceID)
+        case http.MethodPut:
+            h.putDeviceKeys(w, r, userID, deviceID)
+        case http.MethodDelete:
+            h.deleteDeviceKeys(w, userID, deviceID)
+        default:
+            http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        }
+    case "prekeys":
+        switch r.Method {
+        case http.MethodGet:
+            h.countPrekeys(w, userID, deviceID)
+        case http.MethodPost:
+            h.uploadPrekeys(w, r, userID, deviceID)
+        default:
+            http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        }
+    default:
+        http.NotFound(w, r)
+    }
+}
+
+func (h *Handlers) getDeviceKeys(w http.ResponseWriter, userID int64, deviceID string) {
+    keys, err := h.db.GetDeviceKeys(userID, deviceID)
+    if err != nil {
+        log.Printf("Error getting device keys: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if keys == nil {
+        http.Error(w, "Device keys not found", http.StatusNotFound)
+        return
+    }
+
+    counts, err := h.db.CountOneTimePrekeys(userID, deviceID)
+    if err != nil {
+        log.Printf("Error counting prekeys: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    writeJSON(w, http.StatusOK, deviceKeysResponse{DeviceKeys: keys, Prekeys: counts})
+}
+
+// putDeviceKeys stores the device's identity key and signed prekey. The
+// signed prekey may be replaced at any time; replacing the identity key
+// also discards the device's one-time prekeys.
+func (h *Handlers) putDeviceKeys(w http.ResponseWriter, r *http.Request, userID int64, deviceID string) {
+    var req deviceKeysRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+
+    identity, err := encryption.ParseIdentityKey(req.IdentityKey)
+    if err != nil {
+        http.Error(w, "identity_key: "+err.Error(), http.StatusBadRequest)
+        return
+    }
+    if err := validateSignedPrekey(identity, req.SignedPrekey, func(b []byte) error {
+        _, err := encryption.ParseClassicalKey(b)
+        return err
+    }); err != nil {
+        http.Error(w, "signed_prekey: "+err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    keys := &models.DeviceKeys{
+        UserID:       userID,
+        DeviceID:     deviceID,
+        IdentityKey:  req.IdentityKey,
+        SignedPrekey: req.SignedPrekey,
+    }
+    if err := h.db.SaveDeviceKeys(keys); err != nil {
+        log.Printf("Error saving device keys: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    writeJSON(w, http.StatusOK, keys)
+}
+
+func (h *Handlers) deleteDeviceKeys(w http.ResponseWriter, userID int64, deviceID string) {
+    deleted, err := h.db.DeleteDeviceKeys(userID, deviceID)
+    if err != nil {
+        log.Printf("Error deleting device keys: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if !deleted {
+        http.Error(w, "Device keys not found", http.StatusNotFound)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handlers) countPrekeys(w http.ResponseWriter, userID int64, deviceID string) {
+    counts, err := h.db.CountOneTimePrekeys(userID, deviceID)
+    if err != nil {
+        log.Printf("Error counting prekeys: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    writeJSON(w, http.StatusOK, counts)
+}
+
+// uploadPrekeys adds one-time prekeys. Post-quantum prekeys must be signed
+// by the device identity key; classical ones are taken as they are, like in
+// X3DH.
+func (h *Handlers) uploadPrekeys(w http.ResponseWriter, r *http.Request, userID int64, deviceID string) {
+    var req prekeysRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+    if len(req.PQPrekeys) > maxPrekeyBatch || len(req.ClassicalPrekeys) > maxPrekeyBatch {
+        http.Error(w, fmt.Sprintf("At most %d prekeys of each kind per upload", maxPrekeyBatch), http.StatusBadRequest)
+        return
+    }
+
+    keys, err := h.db.GetDeviceKeys(userID, deviceID)
+    if err != nil {
+        log.Printf("Error getting device keys: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if keys == nil {
+        http.Error(w, "Upload the device keys first", http.StatusConflict)
+        return
+    }
+    identity, err := encryption.ParseIdentityKey(keys.IdentityKey)
+    if err != nil {
+        log.Printf("Error parsing stored identity key of %d/%s: %v", userID, deviceID, err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+
+    for i, prekey := range req.PQPrekeys {
+        if err := validateSignedPrekey(identity, prekey, func(b []byte) error {
+            _, err := encryption.ParsePublicKey(b)
+            return err
+        }); err != nil {
+            http.Error(w, fmt.Sprintf("pq_prekeys[%d]: %v", i, err), http.StatusBadRequest)
+            return
+        }
+    }
+    for i := range req.ClassicalPrekeys {
+        prekey := &req.ClassicalPrekeys[i]
+        if prekey.KeyID <= 0 {
+            http.Error(w, fmt.Sprintf("classical_prekeys[%d]: key_id must be positive", i), http.StatusBadRequest)
+            return
+        }
+        if _, err := encryption.ParseClassicalKey(prekey.PublicKey); err != nil {
+            http.Error(w, fmt.Sprintf("classical_prekeys[%d]: %v", i, err), http.StatusBadRequest)
+            return
+        }
+        prekey.Signature = nil
+    }
+
+    _, err = h.db.AddOneTimePrekeys(userID, deviceID, req.PQPrekeys, req.ClassicalPrekeys, maxPrekeyStock)
+    if errors.Is(err, repository.ErrPrekeyStockFull) {
+        http.Error(w, fmt.Sprintf("A device may hold at most %d prekeys of each kind", maxPrekeyStock), http.StatusBadRequest)
+        return
+    }
+    if errors.Is(err, repository.ErrNoDeviceKeys) {
+        http.Error(w, "Upload the device keys first", http.StatusConflict)
+        return
+    }
+    if err != nil {
+        log.Printf("Error adding prekeys: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    h.countPrekeys(w, userID, deviceID)
+}
+
+// claimPrekeyBundles serves GET /api/users/{id}/prekeys. It returns a
+// bundle for every device of the user, or only for ?device_id=, and uses up
+// one one-time prekey of each kind per bundle. Claims are rate limited per
+// requester.
+func (h *Handlers) claimPrekeyBundles(w http.ResponseWriter, r *http.Request, userID, targetID int64) {
+    deviceID := r.URL.Query().Get("device_id")
+    if deviceID != "" && !deviceIDPattern.MatchString(deviceID) {
+        http.Error(w, "Invalid device ID", http.StatusBadRequest)
+        return
+    }
+
+    if ok, retryAfter := h.prekeyClaims.allow(userID, h.clock.Now()); !ok {
+        w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+        http.Error(w, "Too many prekey requests", http.StatusTooManyRequests)
+        return
+    }
+
+    if userID != targetID {
+        blocked, err := h.db.IsBlocked(userID, targetID)
+        if err != nil {
+            log.Printf("Error checking blocks: %v", err)
+            http.Error(w, "Internal server error", http.StatusInternalServerError)
+            return
+        }
+        if blocked {
+            http.Error(w, errBlocked.Error(), http.StatusForbidden)
+            return
+        }
+    }
+
+    bundles, err := h.db.ClaimPrekeyBundles(targetID, deviceID)
+    if err != nil {
+        log.Printf("Error claiming prekey bundles: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if len(bundles) == 0 {
+        http.Error(w, "No prekeys published", http.StatusNotFound)
+        return
+    }
+
+    for _, bundle := range bundles {
+        h.warnIfPrekeysLow(targetID, bundle.DeviceID)
+    }
+    writeJSON(w, http.StatusOK, prekeyBundlesResponse{UserID: targetID, Devices: bundles})
+}
+
+// warnIfPrekeysLow asks a device to upload more one-time prekeys once
+// either kind drops below the watermark. Offline devices find out from the
+// counts when they next look.
+func (h *Handlers) warnIfPrekeysLow(userID int64, deviceID string) {
+    counts, err := h.db.CountOneTimePrekeys(userID, deviceID)
+    if err != nil {
+        log.Printf("Error counting prekeys: %v", err)
+        return
+    }
+    if counts.PQ >= prekeyLowWatermark && counts.Classical >= prekeyLowWatermark {
+        return
+    }
+
+    content, _ := json.Marshal(prekeysLowEvent{DeviceID: deviceID, PrekeyCounts: counts})
+    frame, _ := json.Marshal(WSMessage{
+        Type:      MessageTypePrekeysLow,
+        Content:   content,
+        Timestamp: time.Now().Unix(),
+    })
+    h.hub.sendToDevice(userID, deviceID, frame)
+}
+
+// validateSignedPrekey checks a prekey's ID, encoding and signature
+func validateSignedPrekey(identity *encryption.IdentityKey, prekey models.Prekey, parse func([]byte) error) error {
+    if prekey.KeyID <= 0 {
+        return errors.New("key_id must be positive")
+    }
+    if err := parse(prekey.PublicKey); err != nil {
+        return err
+    }
+    return identity.Verify(prekey.PublicKey, prekey.Signature)
+}
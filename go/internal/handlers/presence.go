@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"quantum-chat/internal/middleware"
+	"quantum-chat/internal/models"
+)
+
+// presenceEvent is emitted by the hub when a user's first device connects or
+// their last device disconnects
+type presenceEvent struct {
+    userID int64
+    online bool
+    at     time.Time
+}
+
+// runPresence persists last-seen times and pushes presence changes to the
+// users allowed to see them. Events are handled one at a time so a quick
+// reconnect cannot overtake the disconnect before it.
+func (h *Handlers) runPresence() {
+    for event := range h.hub.presence {
+        if err := h.publishPresence(event); err != nil {
+            log.Printf("Presence: Error publishing presence of %d: %v", event.userID, err)
+        }
+    }
+}
+
+func (h *Handlers) publishPresence(event presenceEvent) error {
+    presence := &models.Presence{UserID: event.userID, Status: models.PresenceOnline}
+    if !event.online {
+        if err := h.db.UpdateLastSeen(event.userID, event.at); err != nil {
+            return err
+        }
+        presence.Status = models.PresenceOffline
+        presence.LastSeenAt = &event.at
+    }
+
+    settings, err := h.db.GetPrivacySettings(event.userID)
+    if err != nil || settings == nil {
+        return err
+    }
+    if settings.PresenceVisibility == models.VisibilityNobody {
+        return nil
+    }
+
+    // Only contacts, and with everyone visibility also users who share a
+    // conversation, are interested in live updates; everyone else can still
+    // ask through the REST endpoint
+    audience, err := h.db.GetContactIDs(event.userID)
+    if err != nil {
+        return err
+    }
+    if settings.PresenceVisibility == models.VisibilityEveryone {
+        peers, err := h.db.GetConversationPeerIDs(event.userID)
+        if err != nil {
+            return err
+        }
+        audience = uniqueIDs(append(audience, peers...), event.userID)
+    }
+    blocked, err := h.db.GetBlockedEitherWay(event.userID, audience)
+    if err != nil {
+        return err
+    }
+    audience = withoutIDs(audience, blocked)
+
+    content, _ := json.Marshal(presence)
+    frame, _ := json.Marshal(WSMessage{
+        Type:      MessageTypePresence,
+        Content:   content,
+        SenderID:  event.userID,
+        Timestamp: event.at.Unix(),
+    })
+    h.hub.fanout(audience, frame)
+    return nil
+}
+
+// canSeePresence applies the target's presence visibility to a viewer
+func (h *Handlers) canSeePresence(viewerID, targetID int64, settings *models.PrivacySettings) (bool, error) {
+    if viewerID == targetID {
+        return true, nil
+    }
+    blocked, err := h.db.IsBlocked(viewerID, targetID)
+    if err != nil || blocked {
+        return false, err
+    }
+    switch settings.PresenceVisibility {
+    case models.VisibilityEveryone:
+        return true, nil
+    case models.VisibilityContacts:
+        return h.db.IsContact(viewerID, targetID)
+    default:
+        return false, nil
+    }
+}
+
+// handlePresence serves GET /api/users/{id}/presence
+func (h *Handlers) handlePresence(w http.ResponseWriter, viewerID, targetID int64) {
+    settings, err := h.db.GetPrivacySettings(targetID)
+    if err != nil {
+        log.Printf("Error getting privacy settings: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if settings == nil {
+        http.Error(w, "User not found", http.StatusNotFound)
+        return
+    }
+
+    visible, err := h.canSeePresence(viewerID, targetID, settings)
+    if err != nil {
+        log.Printf("Error checking presence visibility: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if !visible {
+        http.Error(w, "Presence is not visible", http.StatusForbidden)
+        return
+    }
+
+    presence := &models.Presence{UserID: targetID, Status: models.PresenceOffline}
+    if h.hub.isOnline(targetID) {
+        presence.Status = models.PresenceOnline
+    } else {
+        presence.LastSeenAt, err = h.db.GetLastSeen(targetID)
+        if err != nil {
+            log.Printf("Error getting last seen: %v", err)
+            http.Error(w, "Internal server error", http.StatusInternalServerError)
+            return
+        }
+    }
+    writeJSON(w, http.StatusOK, presence)
+}
+
+// handlePrivacySettings serves GET and PUT /api/settings/privacy
+func (h *Handlers) handlePrivacySettings(w http.ResponseWriter, r *http.Request) {
+    userID, ok := middleware.GetUserIDFromContext(r.Context())
+    if !ok {
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    settings, err := h.db.GetPrivacySettings(userID)
+    if err != nil || settings == nil {
+        log.Printf("Error getting privacy settings: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+
+    switch r.Method {
+    case http.MethodGet:
+        writeJSON(w, http.StatusOK, settings)
+
+    case http.MethodPut, http.MethodPatch:
+        // Fields missing from the body keep their current value
+        if err := json.NewDecoder(r.Body).Decode(settings); err != nil {
+            http.Error(w, "Invalid request body", http.StatusBadRequest)
+            return
+        }
+        if !validVisibility(settings.PresenceVisibility) {
+            http.Error(w, "presence_visibility must be everyone, contacts or nobody", http.StatusBadRequest)
+            return
+        }
+        if settings.MessageRequests != models.VisibilityEveryone && settings.MessageRequests != models.VisibilityNobody {
+            http.Error(w, "message_requests must be everyone or nobody", http.StatusBadRequest)
+            return
+        }
+
+        if err := h.db.UpdatePrivacySettings(userID, settings); err != nil {
+            log.Printf("Error updating privacy settings: %v", err)
+            http.Error(w, "Internal server error", http.StatusInternalServerError)
+            return
+        }
+        writeJSON(w, http.StatusOK, settings)
+
+    default:
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+    }
+}
+
+func validVisibility(v string) bool {
+    switch v {
+    case models.VisibilityEveryone, models.VisibilityContacts, models.VisibilityNobody:
+        return true
+    }
+    return false
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter allows each user a number of events per fixed window. All
+// counts are dropped when a window ends, so the map stays bounded by the
+// users active within one window.
+type rateLimiter struct {
+    limit  int
+    window time.Duration
+    mu     sync.Mutex
+    start  time.Time
+    counts map[int64]int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+    return &rateLimiter{
+        limit:  limit,
+        window: window,
+        counts: make(map[int64]int),
+    }
+}
+
+// allow counts an event for userID at now and reports whether it is within
+// the limit. When it is not, it also returns how long until the next window.
+func (l *rateLimiter) allow(userID int64, now time.Time) (bool, time.Duration) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    if now.Sub(l.start) >= l.window {
+        l.start = now
+        clear(l.counts)
+    }
+    if l.counts[userID] >= l.limit {
+        return false, l.start.Add(l.window).Sub(now)
+    }
+    l.counts[userID]++
+    return true, 0
+}
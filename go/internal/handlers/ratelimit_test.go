@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+    clock := newFakeClock()
+    limiter := newRateLimiter(2, time.Minute)
+
+    for i := 0; i < 2; i++ {
+        if ok, _ := limiter.allow(1, clock.Now()); !ok {
+            t.Fatalf("event %d refused", i+1)
+        }
+    }
+    ok, retryAfter := limiter.allow(1, clock.Now())
+    if ok || retryAfter != time.Minute {
+        t.Fatalf("third event = %v, retry after %v; want refused for a minute", ok, retryAfter)
+    }
+
+    // Users are counted separately
+    if ok, _ := limiter.allow(2, clock.Now()); !ok {
+        t.Fatal("other user refused")
+    }
+
+    clock.Advance(59 * time.Second)
+    if ok, retryAfter := limiter.allow(1, clock.Now()); ok || retryAfter != time.Second {
+        t.Fatalf("before the window ends = %v, retry after %v", ok, retryAfter)
+    }
+
+    clock.Advance(time.Second)
+    if ok, _ := limiter.allow(1, clock.Now()); !ok {
+        t.Fatal("event refused in the next window")
+    }
+}
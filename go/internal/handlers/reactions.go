@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"quantum-chat/internal/models"
+)
+
+// Reaction size limits
+const (
+    maxEmojiLength      = 32
+    maxReactionBlobSize = 1024
+)
+
+// Reaction actions reported in reaction events
+const (
+    reactionAdded   = "added"
+    reactionRemoved = "removed"
+)
+
+// reactionRequest is the content of a reaction_add frame. Exactly one of
+// Emoji and Ciphertext is set; Ciphertext is an end-to-end encrypted
+// reaction the server stores without looking inside.
+type reactionRequest struct {
+    Emoji      string `json:"emoji,omitempty"`
+    Ciphertext []byte `json:"ciphertext,omitempty"`
+}
+
+// reactionEvent is pushed to the conversation when a reaction changes
+type reactionEvent struct {
+    Action     string `json:"action"`
+    UserID     int64  `json:"user_id"`
+    Emoji      string `json:"emoji,omitempty"`
+    Ciphertext []byte `json:"ciphertext,omitempty"`
+}
+
+func (req reactionRequest) validate() error {
+    switch {
+    case req.Emoji != "" && len(req.Ciphertext) > 0:
+        return errors.New("reaction must be either emoji or ciphertext")
+    case req.Emoji != "":
+        if len(req.Emoji) > maxEmojiLength {
+            return errors.New("emoji is too long")
+        }
+    case len(req.Ciphertext) > 0:
+        if len(req.Ciphertext) > maxReactionBlobSize {
+            return errors.New("reaction ciphertext is too large")
+        }
+    default:
+        return errors.New("reaction requires emoji or ciphertext")
+    }
+    return nil
+}
+
+// handleReaction adds or removes the client's reaction to a message and fans
+// the change out to everyone in the conversation
+func (c *Client) handleReaction(wsMsg *WSMessage) error {
+    h := c.hub.handlers
+
+    if wsMsg.MessageID == 0 {
+        c.sendError("Reaction requires message_id")
+        return nil
+    }
+
+    msg, err := h.db.GetMessage(wsMsg.MessageID)
+    if err != nil {
+        return err
+    }
+    participant := false
+    if msg != nil && msg.DeletedAt == nil && !h.isExpired(msg) {
+        participant, err = h.db.IsMessageParticipant(msg.ID, c.UserID)
+        if err != nil {
+            return err
+        }
+    }
+    if !participant {
+        c.sendError(errMessageNotFound.Error())
+        return nil
+    }
+    if msg.Type == models.MessageTypeSystem {
+        c.sendError("Cannot react to system messages")
+        return nil
+    }
+
+    event := reactionEvent{UserID: c.UserID}
+    if wsMsg.Type == MessageTypeReactionAdd {
+        var req reactionRequest
+        if err := json.Unmarshal(wsMsg.Content, &req); err != nil {
+            c.sendError("Invalid reaction")
+            return nil
+        }
+        if err := req.validate(); err != nil {
+            c.sendError(err.Error())
+            return nil
+        }
+
+        encrypted := len(req.Ciphertext) > 0
+        if !encrypted && msg.ConversationID != 0 {
+            conv, err := h.db.GetConversation(msg.ConversationID)
+            if err != nil {
+                return err
+            }
+            if conv != nil && conv.E2ERequired {
+                c.sendError("This conversation requires encrypted reactions")
+                return nil
+            }
+        }
+        reaction := req.Ciphertext
+        if !encrypted {
+            reaction = []byte(req.Emoji)
+        }
+        if err := h.db.SetReaction(msg.ID, c.UserID, reaction, encrypted); err != nil {
+            return err
+        }
+        event.Action = reactionAdded
+        event.Emoji = req.Emoji
+        event.Ciphertext = req.Ciphertext
+    } else {
+        removed, err := h.db.RemoveReaction(msg.ID, c.UserID)
+        if err != nil {
+            return err
+        }
+        if !removed {
+            return nil
+        }
+        event.Action = reactionRemoved
+    }
+
+    recipients, err := h.db.GetMessageRecipientIDs(msg.ID)
+    if err != nil {
+        return err
+    }
+    recipients = append(recipients, msg.SenderID)
+
+    content, _ := json.Marshal(event)
+    frame, _ := json.Marshal(WSMessage{
+        Type:           MessageTypeReaction,
+        Content:        content,
+        ConversationID: msg.ConversationID,
+        SenderID:       c.UserID,
+        Timestamp:      time.Now().Unix(),
+        MessageID:      msg.ID,
+    })
+    c.hub.fanout(uniqueIDs(recipients, 0), frame)
+    return nil
+}
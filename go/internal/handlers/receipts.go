@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"quantum-chat/internal/middleware"
+	"quantum-chat/internal/models"
+)
+
+// readRequest marks messages as read, either by ID or by a watermark: every
+// message in ConversationID up to and including UpToID
+type readRequest struct {
+    MessageIDs     []int64 `json:"message_ids,omitempty"`
+    ConversationID int64   `json:"conversation_id,omitempty"`
+    UpToID         int64   `json:"up_to_id,omitempty"`
+}
+
+// ackEvent is the content of an ack frame pushed to a message sender when a
+// recipient's delivery state moves forward
+type ackEvent struct {
+    Status         string  `json:"status"`
+    RecipientID    int64   `json:"recipient_id"`
+    ConversationID int64   `json:"conversation_id,omitempty"`
+    MessageIDs     []int64 `json:"message_ids"`
+}
+
+func (req readRequest) validate() error {
+    if len(req.MessageIDs) == 0 && req.UpToID == 0 {
+        return errors.New("message_ids or up_to_id is required")
+    }
+    if req.UpToID != 0 && req.ConversationID == 0 {
+        return errors.New("up_to_id requires conversation_id")
+    }
+    return nil
+}
+
+// handleMarkRead serves POST /api/messages/read
+func (h *Handlers) handleMarkRead(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    userID, ok := middleware.GetUserIDFromContext(r.Context())
+    if !ok {
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    var req readRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+    if err := req.validate(); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    count, err := h.markRead(userID, req)
+    if err != nil {
+        log.Printf("Error marking messages read: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+
+    writeJSON(w, http.StatusOK, map[string]int{"marked": count})
+}
+
+// markRead persists the read state and pushes an ack to every affected sender
+func (h *Handlers) markRead(userID int64, req readRequest) (int, error) {
+    receipts, err := h.db.MarkMessagesRead(userID, req.MessageIDs, req.ConversationID, req.UpToID)
+    if err != nil {
+        return 0, err
+    }
+    h.notifyTransitions(receipts)
+    return len(receipts), nil
+}
+
+// notifyTransitions pushes ack frames for persisted delivery state changes to
+// the senders' devices, one frame per sender, conversation, recipient and state
+func (h *Handlers) notifyTransitions(receipts []*models.Receipt) {
+    type ackKey struct {
+        senderID, convID, recipientID int64
+        status                        string
+    }
+    events := make(map[ackKey]*ackEvent)
+    var order []ackKey
+    for _, receipt := range receipts {
+        key := ackKey{receipt.SenderID, receipt.ConversationID, receipt.RecipientID, receipt.Status}
+        event, ok := events[key]
+        if !ok {
+            event = &ackEvent{
+                Status:         receipt.Status,
+                RecipientID:    receipt.RecipientID,
+                ConversationID: receipt.ConversationID,
+            }
+            events[key] = event
+            order = append(order, key)
+        }
+        event.MessageIDs = append(event.MessageIDs, receipt.MessageID)
+    }
+
+    for _, key := range order {
+        event := events[key]
+        content, _ := json.Marshal(event)
+        frame := WSMessage{
+            Type:           MessageTypeAck,
+            Content:        content,
+            ConversationID: key.convID,
+            SenderID:       key.recipientID,
+            Timestamp:      time.Now().Unix(),
+        }
+        if len(event.MessageIDs) == 1 {
+            frame.MessageID = event.MessageIDs[0]
+        }
+        frameJSON, _ := json.Marshal(frame)
+        h.hub.sendToUser(key.senderID, frameJSON)
+    }
+}
+
+// handleMessageReceipts serves GET /api/messages/{id}/receipts, the current
+// delivery state per recipient. Only the sender may look at it.
+func (h *Handlers) handleMessageReceipts(w http.ResponseWriter, r *http.Request, userID, messageID int64) {
+    if r.Method != http.MethodGet {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    msg, err := h.db.GetMessage(messageID)
+    if err != nil {
+        log.Printf("Error getting message: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if msg == nil || msg.SenderID != userID {
+        http.Error(w, "Message not found", http.StatusNotFound)
+        return
+    }
+
+    receipts, err := h.db.GetMessageReceipts(messageID)
+    if err != nil {
+        log.Printf("Error getting receipts: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if receipts == nil {
+        receipts = []*models.Receipt{}
+    }
+    writeJSON(w, http.StatusOK, receipts)
+}
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"quantum-chat/internal/middleware"
+	"quantum-chat/internal/models"
+)
+
+// Scheduled message limits
+const (
+    // Scheduled messages are sent with this client_message_id prefix plus
+    // their ID, so a message claimed twice is still stored only once
+    scheduledClientIDPrefix = "sched-"
+
+    // How far ahead a message may be scheduled
+    maxScheduleAhead = 365 * 24 * time.Hour
+
+    // Number of due messages claimed per scheduler query
+    schedulerBatchSize = 100
+
+    // A claim that did not finish within this time is taken over by another
+    // scheduler pass
+    scheduleClaimTimeout = 5 * time.Minute
+)
+
+// scheduleChatMessage validates a chat frame with a send_at and stores it
+// for the scheduler. Retried frames with the same client_message_id return
+// the original scheduled message.
+func (h *Handlers) scheduleChatMessage(senderID int64, wsMsg *WSMessage, origin *Client) error {
+    if len(wsMsg.ClientMessageID) > maxClientMessageIDLength {
+        return reject("client_message_id is too long")
+    }
+    if wsMsg.TTL < 0 || wsMsg.TTL > maxMessageTTL {
+        return reject("ttl is out of range")
+    }
+
+    now := h.clock.Now()
+    sendAt := time.Unix(wsMsg.SendAt, 0)
+    if !sendAt.After(now) {
+        return reject("send_at must be in the future")
+    }
+    if sendAt.Sub(now) > maxScheduleAhead {
+        return reject("send_at is too far in the future")
+    }
+
+    conv, err := h.chatConversation(senderID, wsMsg)
+    if err != nil {
+        return err
+    }
+    if err := checkContent(conv, wsMsg.Content); err != nil {
+        return err
+    }
+    if len(wsMsg.AttachmentIDs) > 0 {
+        err := h.validateAttachments(conv.ID, wsMsg.AttachmentIDs)
+        if err == errTooManyAttachments || err == errUnknownAttachment {
+            return reject(err.Error())
+        }
+        if err != nil {
+            return fmt.Errorf("failed to check attachments: %v", err)
+        }
+    }
+
+    // Keep only what the client chose; the rest is filled in when sending
+    frame := *wsMsg
+    frame.ConversationID = conv.ID
+    frame.ReceiverID = 0
+    frame.SenderID = 0
+    frame.Timestamp = 0
+    frame.SendAt = 0
+    frame.ClientMessageID = ""
+    frameJSON, _ := json.Marshal(frame)
+
+    sm := &models.ScheduledMessage{
+        SenderID:        senderID,
+        ConversationID:  conv.ID,
+        ClientMessageID: wsMsg.ClientMessageID,
+        Message:         frameJSON,
+        SendAt:          sendAt,
+    }
+    if _, err := h.db.CreateScheduledMessage(sm); err != nil {
+        return fmt.Errorf("failed to schedule message: %v", err)
+    }
+
+    h.sendToSender(senderID, origin, scheduledFrame(sm))
+    return nil
+}
+
+// RunScheduler sends due scheduled messages every interval until stop is
+// closed. Several instances may run it at once: claims make sure each
+// message is picked up by one of them.
+func (h *Handlers) RunScheduler(interval time.Duration, stop <-chan struct{}) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        if n, err := h.sendDueMessages(); err != nil {
+            log.Printf("Scheduler: Error sending scheduled messages: %v", err)
+        } else if n > 0 {
+            log.Printf("Scheduler: Sent %d scheduled messages", n)
+        }
+
+        select {
+        case <-ticker.C:
+        case <-stop:
+            return
+        }
+    }
+}
+
+// sendDueMessages claims and sends every message due by the clock's current
+// time through the regular chat path
+func (h *Handlers) sendDueMessages() (int, error) {
+    now := h.clock.Now()
+    total := 0
+    for {
+        claimed, err := h.db.ClaimScheduledMessages(now, now.Add(-scheduleClaimTimeout), schedulerBatchSize)
+        if err != nil {
+            return total, err
+        }
+
+        for _, sm := range claimed {
+            if h.sendScheduled(sm, now) {
+                total++
+            }
+        }
+
+        if len(claimed) < schedulerBatchSize {
+            return total, nil
+        }
+    }
+}
+
+// sendScheduled sends one claimed message and records the outcome. Errors
+// other than rejections leave the claim in place to be retried once it goes
+// stale.
+func (h *Handlers) sendScheduled(sm *models.ScheduledMessage, now time.Time) bool {
+    var wsMsg WSMessage
+    if err := json.Unmarshal(sm.Message, &wsMsg); err != nil {
+        log.Printf("Scheduler: Invalid frame in scheduled message %d: %v", sm.ID, err)
+        h.finishScheduled(sm, models.ScheduledFailed, 0, "invalid message")
+        return false
+    }
+    wsMsg.Type = MessageTypeChat
+    wsMsg.Timestamp = now.Unix()
+    wsMsg.ClientMessageID = fmt.Sprintf("%s%d", scheduledClientIDPrefix, sm.ID)
+
+    msg, err := h.sendChatMessage(sm.SenderID, &wsMsg, nil)
+    var rejected *rejection
+    if errors.As(err, &rejected) {
+        h.finishScheduled(sm, models.ScheduledFailed, 0, rejected.reason)
+        return false
+    }
+    if err != nil {
+        log.Printf("Scheduler: Error sending scheduled message %d: %v", sm.ID, err)
+        return false
+    }
+
+    h.finishScheduled(sm, models.ScheduledSent, msg.ID, "")
+    return true
+}
+
+func (h *Handlers) finishScheduled(sm *models.ScheduledMessage, status string, messageID int64, reason string) {
+    if err := h.db.FinishScheduledMessage(sm.ID, status, messageID, reason); err != nil {
+        log.Printf("Scheduler: Error finishing scheduled message %d: %v", sm.ID, err)
+        return
+    }
+    sm.Status = status
+    sm.MessageID = messageID
+    sm.Error = reason
+    h.hub.sendToUser(sm.SenderID, scheduledFrame(sm))
+}
+
+// scheduledFrame tells the sender's devices about a scheduled message
+func scheduledFrame(sm *models.ScheduledMessage) []byte {
+    content, _ := json.Marshal(sm)
+    frame, _ := json.Marshal(WSMessage{
+        Type:            MessageTypeScheduled,
+        Content:         content,
+        ConversationID:  sm.ConversationID,
+        SenderID:        sm.SenderID,
+        Timestamp:       time.Now().Unix(),
+        MessageID:       sm.MessageID,
+        ClientMessageID: sm.ClientMessageID,
+    })
+    return frame
+}
+
+// handleScheduledMessages serves GET /api/scheduled
+func (h *Handlers) handleScheduledMessages(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    userID, ok := middleware.GetUserIDFromContext(r.Context())
+    if !ok {
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    scheduled, err := h.db.GetScheduledMessages(userID)
+    if err != nil {
+        log.Printf("Error listing scheduled messages: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if scheduled == nil {
+        scheduled = []*models.ScheduledMessage{}
+    }
+    writeJSON(w, http.StatusOK, scheduled)
+}
+
+// handleScheduledMessage serves DELETE /api/scheduled/{id}, cancelling a
+// message that was not sent yet
+func (h *Handlers) handleScheduledMessage(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodDelete {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    userID, ok := middleware.GetUserIDFromContext(r.Context())
+    if !ok {
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    parts := pathSegments(r.URL.Path, "/api/scheduled/")
+    if len(parts) != 1 {
+        http.NotFound(w, r)
+        return
+    }
+    id, err := parseID(parts[0])
+    if err != nil {
+        http.Error(w, "Invalid scheduled message ID", http.StatusBadRequest)
+        return
+    }
+
+    cancelled, err := h.db.CancelScheduledMessage(id, userID)
+    if err != nil {
+        log.Printf("Error cancelling scheduled message: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if !cancelled {
+        http.Error(w, "Scheduled message not found or already sent", http.StatusNotFound)
+        return
+    }
+
+    frame, _ := json.Marshal(WSMessage{
+        Type:      MessageTypeScheduled,
+        Content:   json.RawMessage(fmt.Sprintf(`{"id":%d,"status":"%s"}`, id, models.ScheduledCancelled)),
+        SenderID:  userID,
+        Timestamp: time.Now().Unix(),
+    })
+    h.hub.sendToUser(userID, frame)
+    w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"quantum-chat/internal/encryption"
+	"quantum-chat/internal/middleware"
+	"quantum-chat/internal/models"
+)
+
+const (
+    deliveryTokenSize = 32
+
+    // Sealed messages a receiver may be sent per window. The endpoint is
+    // not authenticated, so this bounds the lookups and stored messages
+    // anyone can cause.
+    sealedDeliveryLimit  = 60
+    sealedDeliveryWindow = time.Minute
+)
+
+// sealedStore is the part of the database sealed delivery uses
+type sealedStore interface {
+    GetDeliveryTokenHash(userID int64) ([]byte, error)
+    SaveSealedMessage(msg *models.Message) error
+}
+
+// sealedMessageRequest carries an encrypted envelope that names the sender
+// inside; the server only learns the receiver
+type sealedMessageRequest struct {
+    ReceiverID int64           `json:"receiver_id"`
+    Content    json.RawMessage `json:"content"`
+}
+
+type deliveryTokenResponse struct {
+    DeliveryToken string `json:"delivery_token"`
+}
+
+type sealedMessageResponse struct {
+    MessageID int64 `json:"message_id"`
+    Timestamp int64 `json:"timestamp"`
+}
+
+// handleDeliveryToken serves /api/sealed/token. PUT opts in to sealed
+// sender, or replaces the token, and returns a new delivery token the user
+// hands to their contacts inside encrypted messages; only its hash is kept.
+// DELETE opts out. Replacing the token is also how a user shuts out senders
+// they cannot block by name.
+func (h *Handlers) handleDeliveryToken(w http.ResponseWriter, r *http.Request) {
+    userID, ok := middleware.GetUserIDFromContext(r.Context())
+    if !ok {
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    switch r.Method {
+    case http.MethodPut:
+        token := make([]byte, deliveryTokenSize)
+        if _, err := rand.Read(token); err != nil {
+            log.Printf("Error generating delivery token: %v", err)
+            http.Error(w, "Internal server error", http.StatusInternalServerError)
+            return
+        }
+        hash := sha256.Sum256(token)
+        if err := h.db.SetDeliveryTokenHash(userID, hash[:]); err != nil {
+            log.Printf("Error saving delivery token: %v", err)
+            http.Error(w, "Internal server error", http.StatusInternalServerError)
+            return
+        }
+        writeJSON(w, http.StatusOK, deliveryTokenResponse{DeliveryToken: base64.RawURLEncoding.EncodeToString(token)})
+
+    case http.MethodDelete:
+        if err := h.db.SetDeliveryTokenHash(userID, nil); err != nil {
+            log.Printf("Error clearing delivery token: %v", err)
+            http.Error(w, "Internal server error", http.StatusInternalServerError)
+            return
+        }
+        w.WriteHeader(http.StatusNoContent)
+
+    default:
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+    }
+}
+
+// handleSealedMessage serves POST /api/sealed/messages. The request is not
+// authenticated: the receiver's delivery token in X-Delivery-Token
+// authorizes it, and the message is stored without a sender. Deliveries are
+// rate limited per receiver.
+func (h *Handlers) handleSealedMessage(w http.ResponseWriter, r *http.Request) {
+    h.deliverSealedMessage(w, r, h.db)
+}
+
+func (h *Handlers) deliverSealedMessage(w http.ResponseWriter, r *http.Request, store sealedStore) {
+    if r.Method != http.MethodPost {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var req sealedMessageRequest
+    r.Body = http.MaxBytesReader(w, r.Body, maxMessageSize)
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ReceiverID <= 0 {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+    if len(req.Content) == 0 {
+        http.Error(w, "content is required", http.StatusBadRequest)
+        return
+    }
+    // Plaintext would give away the sender the envelope is meant to hide
+    if _, err := encryption.ParseEnvelope(req.Content); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    // Unknown receivers, receivers without sealed sender and wrong tokens
+    // look the same, so the endpoint does not reveal who opted in
+    token, err := base64.RawURLEncoding.DecodeString(r.Header.Get("X-Delivery-Token"))
+    if err != nil || len(token) != deliveryTokenSize {
+        http.Error(w, "Invalid delivery token", http.StatusUnauthorized)
+        return
+    }
+    if ok, retryAfter := h.sealedDeliveries.allow(req.ReceiverID, h.clock.Now()); !ok {
+        w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+        http.Error(w, "Too many messages for this receiver", http.StatusTooManyRequests)
+        return
+    }
+    stored, err := store.GetDeliveryTokenHash(req.ReceiverID)
+    if err != nil {
+        log.Printf("Error getting delivery token: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    hash := sha256.Sum256(token)
+    if subtle.ConstantTimeCompare(hash[:], stored) != 1 {
+        http.Error(w, "Invalid delivery token", http.StatusUnauthorized)
+        return
+    }
+
+    msg := &models.Message{
+        ReceiverID: req.ReceiverID,
+        Content:    req.Content,
+        Timestamp:  h.clock.Now().Unix(),
+    }
+    if err := store.SaveSealedMessage(msg); err != nil {
+        log.Printf("Error saving sealed message: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+
+    // Offline receivers get it from the pending replay on their next connect
+    h.hub.sendToUser(msg.ReceiverID, chatFrame(msg))
+    writeJSON(w, http.StatusAccepted, sealedMessageResponse{MessageID: msg.ID, Timestamp: msg.Timestamp})
+}
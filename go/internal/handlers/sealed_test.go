@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"quantum-chat/internal/models"
+)
+
+// fakeSealedStore keeps delivery token hashes and saved messages in memory
+type fakeSealedStore struct {
+    tokenHashes map[int64][]byte // A nil hash means the user opted out
+    saved       []*models.Message
+}
+
+func (s *fakeSealedStore) GetDeliveryTokenHash(userID int64) ([]byte, error) {
+    return s.tokenHashes[userID], nil
+}
+
+func (s *fakeSealedStore) SaveSealedMessage(msg *models.Message) error {
+    msg.ID = int64(len(s.saved) + 1)
+    msg.Type = models.MessageTypeSealed
+    s.saved = append(s.saved, msg)
+    return nil
+}
+
+func testDeliveryToken(b byte) string {
+    return base64.RawURLEncoding.EncodeToString([]byte(strings.Repeat(string(rune(b)), deliveryTokenSize)))
+}
+
+func tokenHash(token string) []byte {
+    raw, _ := base64.RawURLEncoding.DecodeString(token)
+    hash := sha256.Sum256(raw)
+    return hash[:]
+}
+
+// sealedEnvelope is a well-formed AES-256-GCM envelope
+func sealedEnvelope() string {
+    b64 := func(n int) string { return base64.StdEncoding.EncodeToString(make([]byte, n)) }
+    return fmt.Sprintf(`{"v":1,"alg":"aes-256-gcm","kid":"s","nonce":"%s","ct":"%s","pad":256}`, b64(12), b64(256+16))
+}
+
+func postSealed(h *Handlers, store sealedStore, receiverID int64, content, token string) *httptest.ResponseRecorder {
+    body := fmt.Sprintf(`{"receiver_id":%d,"content":%s}`, receiverID, content)
+    r := httptest.NewRequest(http.MethodPost, "/api/sealed/messages", strings.NewReader(body))
+    if token != "" {
+        r.Header.Set("X-Delivery-Token", token)
+    }
+    w := httptest.NewRecorder()
+    h.deliverSealedMessage(w, r, store)
+    return w
+}
+
+func TestSealedMessageDelivery(t *testing.T) {
+    h := newTestHandlers(newFakeClock())
+    receiver := connect(h, 2)
+    token := testDeliveryToken('a')
+    store := &fakeSealedStore{tokenHashes: map[int64][]byte{2: tokenHash(token)}}
+
+    w := postSealed(h, store, 2, sealedEnvelope(), token)
+    if w.Code != http.StatusAccepted {
+        t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusAccepted, w.Body)
+    }
+    var resp sealedMessageResponse
+    if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.MessageID != 1 {
+        t.Fatalf("response %s: %v", w.Body, err)
+    }
+
+    if len(store.saved) != 1 {
+        t.Fatalf("%d messages saved, want 1", len(store.saved))
+    }
+    saved := store.saved[0]
+    if saved.SenderID != 0 || saved.ConversationID != 0 || saved.ReceiverID != 2 {
+        t.Fatalf("saved %+v; want no sender or conversation", saved)
+    }
+    if saved.Timestamp != h.clock.Now().Unix() {
+        t.Fatalf("timestamp = %d, want the clock's %d", saved.Timestamp, h.clock.Now().Unix())
+    }
+
+    frames := received(t, receiver)
+    if len(frames) != 1 || frames[0].Type != MessageTypeSealed || frames[0].SenderID != 0 {
+        t.Fatalf("receiver got %+v, want one sealed frame without sender", frames)
+    }
+}
+
+func TestSealedMessageRejected(t *testing.T) {
+    h := newTestHandlers(newFakeClock())
+    token := testDeliveryToken('a')
+    store := &fakeSealedStore{tokenHashes: map[int64][]byte{2: tokenHash(token), 3: nil}}
+
+    tests := []struct {
+        name       string
+        receiverID int64
+        content    string
+        token      string
+        want       int
+    }{
+        {"no token", 2, sealedEnvelope(), "", http.StatusUnauthorized},
+        {"wrong token", 2, sealedEnvelope(), testDeliveryToken('b'), http.StatusUnauthorized},
+        {"short token", 2, sealedEnvelope(), token[:len(token)-2], http.StatusUnauthorized},
+        {"token not base64", 2, sealedEnvelope(), "!!" + token[2:], http.StatusUnauthorized},
+        {"plaintext", 2, `{"text":"hi"}`, token, http.StatusBadRequest},
+        {"string content", 2, `"hi"`, token, http.StatusBadRequest},
+        {"no content", 2, `null`, token, http.StatusBadRequest},
+        {"no receiver", 0, sealedEnvelope(), token, http.StatusBadRequest},
+    }
+    for _, tt := range tests {
+        if w := postSealed(h, store, tt.receiverID, tt.content, tt.token); w.Code != tt.want {
+            t.Errorf("%s: status = %d, want %d: %s", tt.name, w.Code, tt.want, w.Body)
+        }
+    }
+    if len(store.saved) != 0 {
+        t.Fatalf("%d rejected messages saved", len(store.saved))
+    }
+
+    // Unknown and opted-out receivers cannot be told apart from a wrong token
+    unknown := postSealed(h, store, 99, sealedEnvelope(), token)
+    optedOut := postSealed(h, store, 3, sealedEnvelope(), token)
+    wrong := postSealed(h, store, 2, sealedEnvelope(), testDeliveryToken('b'))
+    for _, w := range []*httptest.ResponseRecorder{optedOut, wrong} {
+        if w.Code != unknown.Code || w.Body.String() != unknown.Body.String() {
+            t.Fatalf("responses differ: %d %q and %d %q", unknown.Code, unknown.Body, w.Code, w.Body)
+        }
+    }
+    if unknown.Code != http.StatusUnauthorized {
+        t.Fatalf("unknown receiver status = %d, want %d", unknown.Code, http.StatusUnauthorized)
+    }
+}
+
+func TestSealedMessageRateLimit(t *testing.T) {
+    clock := newFakeClock()
+    h := newTestHandlers(clock)
+    token := testDeliveryToken('a')
+    store := &fakeSealedStore{tokenHashes: map[int64][]byte{2: tokenHash(token), 3: tokenHash(token)}}
+
+    for i := 0; i < sealedDeliveryLimit; i++ {
+        if w := postSealed(h, store, 2, sealedEnvelope(), token); w.Code != http.StatusAccepted {
+            t.Fatalf("message %d: status = %d", i+1, w.Code)
+        }
+    }
+    w := postSealed(h, store, 2, sealedEnvelope(), token)
+    if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+        t.Fatalf("over the limit: status = %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+    }
+
+    // Other receivers have their own budget, and the window moves on
+    if w := postSealed(h, store, 3, sealedEnvelope(), token); w.Code != http.StatusAccepted {
+        t.Fatalf("other receiver: status = %d", w.Code)
+    }
+    clock.Advance(sealedDeliveryWindow)
+    if w := postSealed(h, store, 2, sealedEnvelope(), token); w.Code != http.StatusAccepted {
+        t.Fatalf("next window: status = %d", w.Code)
+    }
+    if len(store.saved) != sealedDeliveryLimit+2 {
+        t.Fatalf("%d messages saved, want %d", len(store.saved), sealedDeliveryLimit+2)
+    }
+}
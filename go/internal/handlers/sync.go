@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"quantum-chat/internal/models"
+)
+
+// Number of messages loaded per sync query
+const syncBatchSize = 100
+
+// syncRequest carries the last sequence number the client has seen in each
+// conversation it wants to catch up on
+type syncRequest struct {
+    Conversations []*models.ConversationHead `json:"conversations"`
+}
+
+// syncedEvent ends a sync with the current head of every conversation the
+// user is in, so the client can also discover conversations it does not know
+type syncedEvent struct {
+    Conversations []*models.ConversationHead `json:"conversations"`
+}
+
+// handleSync streams every message the client is missing, conversation by
+// conversation in sequence order, followed by a synced frame
+func (c *Client) handleSync(wsMsg WSMessage) {
+    db := c.hub.handlers.db
+
+    var req syncRequest
+    if err := json.Unmarshal(wsMsg.Content, &req); err != nil {
+        c.sendError("Invalid sync request")
+        return
+    }
+
+    heads, err := db.GetConversationHeads(c.UserID)
+    if err != nil {
+        log.Printf("Client sync: Error loading conversation heads for %d: %v", c.UserID, err)
+        c.sendError("Failed to sync")
+        return
+    }
+    member := make(map[int64]int64, len(heads))
+    for _, head := range heads {
+        member[head.ConversationID] = head.LastSeq
+    }
+
+    for _, state := range req.Conversations {
+        lastSeq, ok := member[state.ConversationID]
+        if !ok || state.LastSeq >= lastSeq {
+            continue
+        }
+
+        cursor := state.LastSeq
+        for cursor < lastSeq {
+            messages, err := db.GetMessagesAfterSeq(c.UserID, state.ConversationID, cursor, syncBatchSize, c.hub.handlers.clock.Now())
+            if err != nil {
+                log.Printf("Client sync: Error loading messages for %d: %v", c.UserID, err)
+                c.sendError("Failed to sync")
+                return
+            }
+            for _, msg := range messages {
+                if !c.send(chatFrame(msg)) {
+                    return
+                }
+                cursor = msg.Seq
+            }
+            if len(messages) < syncBatchSize {
+                break
+            }
+        }
+    }
+
+    if heads == nil {
+        heads = []*models.ConversationHead{}
+    }
+    content, _ := json.Marshal(syncedEvent{Conversations: heads})
+    frame, _ := json.Marshal(WSMessage{
+        Type:      MessageTypeSynced,
+        Content:   content,
+        SenderID:  c.UserID,
+        Timestamp: time.Now().Unix(),
+    })
+    c.send(frame)
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"quantum-chat/internal/models"
+	"quantum-chat/internal/repository"
+)
+
+// Thread list page sizes
+const (
+    defaultThreadLimit = 20
+    maxThreadLimit     = 50
+)
+
+var (
+    errReplyNotFound      = errors.New("replied-to message not found in this conversation")
+    errThreadNotFound     = errors.New("thread root not found in this conversation")
+    errNestedThread       = errors.New("thread replies cannot start threads")
+    errReplyOutsideThread = errors.New("replied-to message is not part of the thread")
+)
+
+// isThreadingError reports whether err is a reference error for the client
+func isThreadingError(err error) bool {
+    switch err {
+    case errReplyNotFound, errThreadNotFound, errNestedThread, errReplyOutsideThread:
+        return true
+    }
+    return false
+}
+
+type threadsResponse struct {
+    Threads []*models.Thread `json:"threads"`
+    HasMore bool             `json:"has_more"`
+}
+
+// resolveThreading validates the reply and thread references of a new
+// message against its conversation and fills in its thread root. Replying to
+// a thread reply without naming the thread keeps the reply in that thread.
+func (h *Handlers) resolveThreading(msg *models.Message, userID int64) error {
+    if msg.ThreadRootID != 0 {
+        root, err := h.referencedMessage(msg.ThreadRootID, msg.ConversationID, userID)
+        if err != nil {
+            return err
+        }
+        if root == nil {
+            return errThreadNotFound
+        }
+        if root.ThreadRootID != 0 {
+            return errNestedThread
+        }
+    }
+
+    if msg.ReplyToID != 0 {
+        parent, err := h.referencedMessage(msg.ReplyToID, msg.ConversationID, userID)
+        if err != nil {
+            return err
+        }
+        if parent == nil {
+            return errReplyNotFound
+        }
+        if msg.ThreadRootID == 0 {
+            msg.ThreadRootID = parent.ThreadRootID
+        } else if parent.ID != msg.ThreadRootID && parent.ThreadRootID != msg.ThreadRootID {
+            return errReplyOutsideThread
+        }
+    }
+    return nil
+}
+
+// referencedMessage returns a live, unexpired message of the conversation
+// visible to userID, or nil
+func (h *Handlers) referencedMessage(messageID, convID, userID int64) (*models.Message, error) {
+    msg, err := h.db.GetMessage(messageID)
+    if err != nil || msg == nil {
+        return nil, err
+    }
+    if msg.ConversationID != convID || msg.DeletedAt != nil || h.isExpired(msg) {
+        return nil, nil
+    }
+
+    visible, err := h.db.IsMessageParticipant(msg.ID, userID)
+    if err != nil || !visible {
+        return nil, err
+    }
+    return msg, nil
+}
+
+// handleThreads serves GET /api/conversations/{id}/threads, paginated by the
+// before cursor on last_reply_id
+func (h *Handlers) handleThreads(w http.ResponseWriter, r *http.Request, conv *models.Conversation, userID int64) {
+    before, err := queryID(r, "before")
+    if err != nil {
+        http.Error(w, "Invalid before cursor", http.StatusBadRequest)
+        return
+    }
+
+    limit := defaultThreadLimit
+    if raw := r.URL.Query().Get("limit"); raw != "" {
+        limit, err = strconv.Atoi(raw)
+        if err != nil || limit <= 0 {
+            http.Error(w, "Invalid limit", http.StatusBadRequest)
+            return
+        }
+        if limit > maxThreadLimit {
+            limit = maxThreadLimit
+        }
+    }
+
+    threads, err := h.db.GetThreads(userID, conv.ID, before, limit+1, h.clock.Now())
+    if err != nil {
+        log.Printf("Error getting threads: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+
+    resp := threadsResponse{Threads: threads}
+    if len(threads) > limit {
+        resp.HasMore = true
+        resp.Threads = threads[:limit]
+    }
+    if resp.Threads == nil {
+        resp.Threads = []*models.Thread{}
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+// handleThreadMessages serves one page of the replies in a thread
+func (h *Handlers) handleThreadMessages(w http.ResponseWriter, r *http.Request, conv *models.Conversation, userID, rootID int64) {
+    root, err := h.referencedMessage(rootID, conv.ID, userID)
+    if err != nil {
+        log.Printf("Error getting thread root: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if root == nil || root.ThreadRootID != 0 {
+        http.Error(w, "Thread not found", http.StatusNotFound)
+        return
+    }
+
+    h.serveHistory(w, r, repository.MessageQuery{
+        UserID:         userID,
+        ConversationID: conv.ID,
+        ThreadRootID:   root.ID,
+    })
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"quantum-chat/internal/models"
+	"quantum-chat/internal/transparency"
+)
+
+// keyLog mirrors the Merkle tree of the key transparency log in memory. The
+// database stays the source of truth: the tree catches up on new entries
+// before every read, so appends made by other server instances show up too.
+type keyLog struct {
+    mutex  sync.Mutex
+    tree   *transparency.Tree
+    signer *transparency.Signer
+}
+
+func newKeyLog(signer *transparency.Signer) *keyLog {
+    return &keyLog{tree: transparency.NewTree(), signer: signer}
+}
+
+type logKeyResponse struct {
+    Algorithm string `json:"algorithm"`
+    PublicKey []byte `json:"public_key"`
+}
+
+type inclusionResponse struct {
+    Index     int64    `json:"index"`
+    TreeSize  uint64   `json:"tree_size"`
+    LeafData  []byte   `json:"leaf_data"`
+    AuditPath [][]byte `json:"audit_path"`
+}
+
+type consistencyResponse struct {
+    First  uint64   `json:"first"`
+    Second uint64   `json:"second"`
+    Proof  [][]byte `json:"proof"`
+}
+
+type userKeyLogEntry struct {
+    *models.KeyLogEntry
+    AuditPath [][]byte `json:"audit_path"`
+}
+
+type userKeyLogResponse struct {
+    TreeHead *transparency.TreeHead `json:"tree_head"`
+    Entries  []*userKeyLogEntry     `json:"entries"`
+}
+
+// withKeyLog brings the tree up to date and runs fn while holding it
+func (h *Handlers) withKeyLog(fn func(tree *transparency.Tree) error) error {
+    h.keyLog.mutex.Lock()
+    defer h.keyLog.mutex.Unlock()
+
+    leaves, err := h.db.GetKeyLogLeaves(int64(h.keyLog.tree.Size()))
+    if err != nil {
+        return err
+    }
+    for _, leaf := range leaves {
+        h.keyLog.tree.Append(transparency.LeafHash(leaf))
+    }
+    return fn(h.keyLog.tree)
+}
+
+// treeHead signs the head of the tree at its current size
+func (h *Handlers) treeHead(tree *transparency.Tree) *transparency.TreeHead {
+    root, _ := tree.Root(tree.Size())
+    head := &transparency.TreeHead{
+        TreeSize:  tree.Size(),
+        RootHash:  root,
+        Timestamp: time.Now().UnixMilli(),
+    }
+    h.keyLog.signer.Sign(head)
+    return head
+}
+
+// handleTransparency serves the key transparency log under
+// /api/transparency/: the signing key, signed tree heads, inclusion and
+// consistency proofs, and the entries for one user's keys
+func (h *Handlers) handleTransparency(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    parts := pathSegments(r.URL.Path, "/api/transparency/")
+    switch {
+    case len(parts) == 1 && parts[0] == "key":
+        writeJSON(w, http.StatusOK, logKeyResponse{Algorithm: "ed25519", PublicKey: h.keyLog.signer.PublicKey()})
+    case len(parts) == 1 && parts[0] == "sth":
+        h.serveTreeHead(w)
+    case len(parts) == 1 && parts[0] == "inclusion":
+        h.serveInclusionProof(w, r)
+    case len(parts) == 1 && parts[0] == "consistency":
+        h.serveConsistencyProof(w, r)
+    case len(parts) == 2 && parts[0] == "users":
+        targetID, err := parseID(parts[1])
+        if err != nil {
+            http.Error(w, "Invalid user ID", http.StatusBadRequest)
+            return
+        }
+        h.serveUserKeyLog(w, targetID)
+    default:
+        http.NotFound(w, r)
+    }
+}
+
+func (h *Handlers) serveTreeHead(w http.ResponseWriter) {
+    var head *transparency.TreeHead
+    err := h.withKeyLog(func(tree *transparency.Tree) error {
+        head = h.treeHead(tree)
+        return nil
+    })
+    if err != nil {
+        log.Printf("Error reading key log: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    writeJSON(w, http.StatusOK, head)
+}
+
+// serveInclusionProof serves ?index=&tree_size=; the tree size defaults to
+// the current one
+func (h *Handlers) serveInclusionProof(w http.ResponseWriter, r *http.Request) {
+    index, ok := queryUint(w, r, "index", 0)
+    if !ok {
+        return
+    }
+    entry, err := h.db.GetKeyLogEntry(int64(index))
+    if err != nil {
+        log.Printf("Error getting key log entry: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    if entry == nil {
+        http.Error(w, "Log entry not found", http.StatusNotFound)
+        return
+    }
+
+    size, ok := queryUint(w, r, "tree_size", 0)
+    if !ok {
+        return
+    }
+    var path [][]byte
+    err = h.withKeyLog(func(tree *transparency.Tree) error {
+        if size == 0 {
+            size = tree.Size()
+        }
+        path, err = tree.InclusionProof(index, size)
+        return err
+    })
+    if err == transparency.ErrInvalidSize || err == transparency.ErrInvalidIndex {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    if err != nil {
+        log.Printf("Error proving inclusion: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    writeJSON(w, http.StatusOK, inclusionResponse{Index: entry.Index, TreeSize: size, LeafData: entry.Data, AuditPath: path})
+}
+
+// serveConsistencyProof serves ?first=&second=; second defaults to the
+// current tree size
+func (h *Handlers) serveConsistencyProof(w http.ResponseWriter, r *http.Request) {
+    first, ok := queryUint(w, r, "first", 0)
+    if !ok {
+        return
+    }
+    second, ok := queryUint(w, r, "second", 0)
+    if !ok {
+        return
+    }
+
+    var proof [][]byte
+    err := h.withKeyLog(func(tree *transparency.Tree) error {
+        if second == 0 {
+            second = tree.Size()
+        }
+        var err error
+        proof, err = tree.ConsistencyProof(first, second)
+        return err
+    })
+    if err == transparency.ErrInvalidSize {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    if err != nil {
+        log.Printf("Error proving consistency: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    writeJSON(w, http.StatusOK, consistencyResponse{First: first, Second: second, Proof: proof})
+}
+
+// serveUserKeyLog lists every key the user published with inclusion proofs
+// against a fresh tree head, so users can monitor their own keys and peers
+// can check the keys they were shown
+func (h *Handlers) serveUserKeyLog(w http.ResponseWriter, targetID int64) {
+    entries, err := h.db.GetUserKeyLog(targetID)
+    if err != nil {
+        log.Printf("Error getting user key log: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+
+    response := userKeyLogResponse{Entries: []*userKeyLogEntry{}}
+    err = h.withKeyLog(func(tree *transparency.Tree) error {
+        response.TreeHead = h.treeHead(tree)
+        for _, entry := range entries {
+            path, err := tree.InclusionProof(uint64(entry.Index), tree.Size())
+            if err != nil {
+                return err
+            }
+            response.Entries = append(response.Entries, &userKeyLogEntry{KeyLogEntry: entry, AuditPath: path})
+        }
+        return nil
+    })
+    if err != nil {
+        log.Printf("Error proving inclusion: %v", err)
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+    writeJSON(w, http.StatusOK, response)
+}
+
+// queryUint reads an optional non-negative query parameter, answering 400
+// if it is malformed
+func queryUint(w http.ResponseWriter, r *http.Request, name string, def uint64) (uint64, bool) {
+    raw := r.URL.Query().Get(name)
+    if raw == "" {
+        return def, true
+    }
+    v, err := strconv.ParseUint(raw, 10, 64)
+    if err != nil {
+        http.Error(w, "Invalid "+name, http.StatusBadRequest)
+        return 0, false
+    }
+    return v, true
+}
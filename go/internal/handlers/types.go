@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"encoding/json"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -9,9 +11,46 @@ import (
 
 // WebSocket message types
 const (
-    MessageTypeChat  = "chat"
-    MessageTypeAck   = "ack"
-    MessageTypeError = "error"
+    MessageTypeChat    = "chat"
+    MessageTypeAck     = "ack"
+    MessageTypeError   = "error"
+    MessageTypeRead    = "read"
+    MessageTypeSync    = "sync"
+    MessageTypeSynced  = "synced"
+    MessageTypeEdit    = "edit"
+    MessageTypeEdited  = "edited"
+    MessageTypeDelete  = "delete"
+    MessageTypeDeleted = "deleted"
+
+    MessageTypeReactionAdd    = "reaction_add"
+    MessageTypeReactionRemove = "reaction_remove"
+    MessageTypeReaction       = "reaction"
+
+    // Sent when the server deletes a disappearing message
+    MessageTypeExpired = "expired"
+
+    // Sent to the sender's devices when a scheduled message changes state
+    MessageTypeScheduled = "scheduled"
+
+    // Announcements from the server's admins and key change notices
+    MessageTypeSystem = "system"
+
+    // Messages whose sender only the recipient can see
+    MessageTypeSealed = "sealed"
+
+    // Sent when a user receives or gets an answer to a contact request
+    MessageTypeContact = "contact"
+
+    // Sent to a device whose one-time prekeys are running low
+    MessageTypePrekeysLow = "prekeys_low"
+
+    // Sent to a conversation's members when its settings change
+    MessageTypeConversation = "conversation"
+
+    // Ephemeral events, forwarded but never stored
+    MessageTypeTypingStart = "typing_start"
+    MessageTypeTypingStop  = "typing_stop"
+    MessageTypePresence    = "presence"
 )
 
 // WebSocket timeouts and limits
@@ -27,24 +66,63 @@ const (
 
     // Maximum message size allowed from peer
     maxMessageSize = 512 * 1024
+
+    // Maximum length of a client-chosen message ID
+    maxClientMessageIDLength = 64
+
+    // Broadcasts waiting for the hub loop before new ones are dropped
+    broadcastQueueSize = 256
 )
 
 // WSMessage represents a WebSocket message
 type WSMessage struct {
-    Type       string          `json:"type"`
-    Content    json.RawMessage `json:"content"`
-    ReceiverID int64          `json:"receiver_id,omitempty"`
-    SenderID   int64          `json:"sender_id,omitempty"`
-    Timestamp  int64          `json:"timestamp,omitempty"`
-    MessageID  int64          `json:"message_id,omitempty"`
+    Type           string          `json:"type"`
+    Content        json.RawMessage `json:"content"`
+    ReceiverID     int64           `json:"receiver_id,omitempty"`
+    ConversationID int64           `json:"conversation_id,omitempty"`
+    SenderID       int64           `json:"sender_id,omitempty"`
+    Timestamp      int64           `json:"timestamp,omitempty"`
+    MessageID      int64           `json:"message_id,omitempty"`
+    Seq            int64           `json:"seq,omitempty"`
+    Version        int             `json:"version,omitempty"`
+
+    // Optional references to a quoted message and to the root of the thread
+    // the message belongs to; both must be in the same conversation
+    ReplyToMessageID int64 `json:"reply_to_message_id,omitempty"`
+    ThreadRootID     int64 `json:"thread_root_id,omitempty"`
+
+    // TTL optionally shortens the lifetime of a chat message in seconds;
+    // ExpiresAt is the resulting expiry the server sends along
+    TTL       int   `json:"ttl,omitempty"`
+    ExpiresAt int64 `json:"expires_at,omitempty"`
+
+    // AttachmentIDs references blobs uploaded to the conversation
+    AttachmentIDs []string `json:"attachment_ids,omitempty"`
+
+    // SendAt, a Unix time in the future, schedules a chat message instead of
+    // sending it right away
+    SendAt int64 `json:"send_at,omitempty"`
+
+    // ClientMessageID is an optional idempotency key chosen by the sender;
+    // resending a chat frame with the same key returns the original message
+    ClientMessageID string `json:"client_message_id,omitempty"`
 }
 
 // Client represents a connected WebSocket client
 type Client struct {
-    UserID int64
-    Conn   *websocket.Conn
-    Send   chan []byte
-    hub    *Hub
+    UserID   int64
+    DeviceID string
+    Conn     *websocket.Conn
+    Send     chan []byte
+    hub      *Hub
+
+    // done is closed once the hub drops the client; Send is never closed so
+    // that concurrent senders cannot panic
+    done      chan struct{}
+    closeOnce sync.Once
+
+    // syncing is set while a sync runs; a client gets one at a time
+    syncing atomic.Bool
 }
 
 var newline = []byte{'\n'}
\ No newline at end of file
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// Typing indicator timing
+const (
+    // Minimum interval between two typing_start events forwarded for the
+    // same client and chat; starts in between only extend the expiry
+    typingThrottle = 3 * time.Second
+
+    // A typing indicator that is not refreshed within this time is stopped
+    // by the server
+    typingTimeout = 6 * time.Second
+)
+
+// typingKey identifies one client typing in one chat, which is either a
+// conversation or a direct peer
+type typingKey struct {
+    client         *Client
+    conversationID int64
+    peerID         int64
+}
+
+type typingState struct {
+    lastSent   time.Time
+    recipients []int64
+    timer      *time.Timer
+}
+
+// typingTracker forwards typing indicators between clients. Indicators are
+// purely in memory and are never persisted.
+type typingTracker struct {
+    hub    *Hub
+    mu     sync.Mutex
+    states map[typingKey]*typingState
+}
+
+func newTypingTracker(hub *Hub) *typingTracker {
+    return &typingTracker{
+        hub:    hub,
+        states: make(map[typingKey]*typingState),
+    }
+}
+
+// start forwards a typing_start, throttled, and (re)arms the expiry timer
+func (t *typingTracker) start(key typingKey, recipients []int64) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    state, ok := t.states[key]
+    if !ok {
+        state = &typingState{}
+        state.timer = time.AfterFunc(typingTimeout, func() { t.expire(key, state) })
+        t.states[key] = state
+    } else {
+        state.timer.Reset(typingTimeout)
+    }
+    state.recipients = recipients
+
+    if time.Since(state.lastSent) < typingThrottle {
+        return
+    }
+    state.lastSent = time.Now()
+    t.forward(key, MessageTypeTypingStart, recipients)
+}
+
+// stop forwards a typing_stop if the client is currently typing in the chat
+func (t *typingTracker) stop(key typingKey) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    state, ok := t.states[key]
+    if !ok {
+        return
+    }
+    state.timer.Stop()
+    delete(t.states, key)
+    t.forward(key, MessageTypeTypingStop, state.recipients)
+}
+
+// clientGone stops every indicator of a disconnecting client
+func (t *typingTracker) clientGone(client *Client) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    for key, state := range t.states {
+        if key.client != client {
+            continue
+        }
+        state.timer.Stop()
+        delete(t.states, key)
+        t.forward(key, MessageTypeTypingStop, state.recipients)
+    }
+}
+
+func (t *typingTracker) expire(key typingKey, state *typingState) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    // The state may have been stopped or replaced while the timer fired
+    if t.states[key] != state {
+        return
+    }
+    delete(t.states, key)
+    t.forward(key, MessageTypeTypingStop, state.recipients)
+    log.Printf("Typing: Indicator of client %d/%s expired", key.client.UserID, key.client.DeviceID)
+}
+
+// forward sends a typing frame to the recipients. The caller must hold t.mu.
+func (t *typingTracker) forward(key typingKey, messageType string, recipients []int64) {
+    frame, _ := json.Marshal(WSMessage{
+        Type:           messageType,
+        ConversationID: key.conversationID,
+        ReceiverID:     key.peerID,
+        SenderID:       key.client.UserID,
+        Timestamp:      time.Now().Unix(),
+    })
+    t.hub.fanout(recipients, frame)
+}
+
+// handleTyping routes a typing_start or typing_stop frame to the peer or the
+// other conversation members. Member lists come from the member cache; only
+// starts, which the tracker throttles anyway, check blocks and contacts.
+func (c *Client) handleTyping(wsMsg *WSMessage) error {
+    key := typingKey{client: c}
+    var recipients []int64
+    start := wsMsg.Type == MessageTypeTypingStart
+
+    switch {
+    case wsMsg.ConversationID != 0:
+        members, err := c.hub.handlers.members.members(wsMsg.ConversationID)
+        if err != nil {
+            return err
+        }
+        isMember := false
+        for _, memberID := range members {
+            if memberID == c.UserID {
+                isMember = true
+            } else {
+                recipients = append(recipients, memberID)
+            }
+        }
+        if !isMember {
+            c.sendError("Not a member of this conversation")
+            return nil
+        }
+        if start && len(recipients) > 0 {
+            blocked, err := c.hub.handlers.db.GetBlockedEitherWay(c.UserID, recipients)
+            if err != nil {
+                return err
+            }
+            recipients = withoutIDs(recipients, blocked)
+        }
+        key.conversationID = wsMsg.ConversationID
+    case wsMsg.ReceiverID != 0:
+        if start {
+            err := c.hub.handlers.checkDirectMessage(c.UserID, wsMsg.ReceiverID)
+            if isContactError(err) {
+                c.sendError(err.Error())
+                return nil
+            }
+            if err != nil {
+                return err
+            }
+        }
+        key.peerID = wsMsg.ReceiverID
+        recipients = []int64{wsMsg.ReceiverID}
+    default:
+        c.sendError("Typing requires receiver_id or conversation_id")
+        return nil
+    }
+
+    if start {
+        c.hub.typing.start(key, recipients)
+    } else {
+        c.hub.typing.stop(key)
+    }
+    return nil
+}
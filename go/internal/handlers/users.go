@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+
+	"quantum-chat/internal/middleware"
+	"quantum-chat/internal/repository"
+)
+
+// handleUser serves /api/users/{id}/... resources
+func (h *Handlers) handleUser(w http.ResponseWriter, r *http.Request) {
+    userID, ok := middleware.GetUserIDFromContext(r.Context())
+    if !ok {
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    parts := pathSegments(r.URL.Path, "/api/users/")
+    if len(parts) != 2 {
+        http.NotFound(w, r)
+        return
+    }
+    targetID, err := parseID(parts[0])
+    if err != nil {
+        http.Error(w, "Invalid user ID", http.StatusBadRequest)
+        return
+    }
+
+    switch parts[1] {
+    case "messages":
+        if r.Method != http.MethodGet {
+            http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+            return
+        }
+        h.serveHistory(w, r, repository.MessageQuery{UserID: userID, PeerID: targetID})
+    case "presence":
+        if r.Method != http.MethodGet {
+            http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+            return
+        }
+        h.handlePresence(w, userID, targetID)
+    case "keys":
+        if r.Method != http.MethodGet {
+            http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+            return
+        }
+        h.serveUserKeys(w, r, targetID)
+    case "prekeys":
+        if r.Method != http.MethodGet {
+            http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+            return
+        }
+        h.claimPrekeyBundles(w, r, userID, targetID)
+    default:
+        http.NotFound(w, r)
+    }
+}
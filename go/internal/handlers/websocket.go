@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"log"
 	"net/http"
 	"quantum-chat/internal/middleware"
+	"regexp"
 
 	"github.com/gorilla/websocket"
 )
@@ -17,6 +20,9 @@ var upgrader = websocket.Upgrader{
     EnableCompression: true,
 }
 
+// Device IDs are chosen by clients, so keep them short and printable
+var deviceIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
 func (h *Handlers) handleWebSocket(w http.ResponseWriter, r *http.Request) {
     // Get user ID from context (set by auth middleware)
     userID, ok := middleware.GetUserIDFromContext(r.Context())
@@ -26,7 +32,20 @@ func (h *Handlers) handleWebSocket(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    log.Printf("WebSocket: Attempting connection for user %d", userID)
+    // Each connection belongs to a device; clients that do not name one get
+    // a fresh ID for this session
+    deviceID := r.URL.Query().Get("device_id")
+    if deviceID == "" {
+        deviceID = r.Header.Get("X-Device-ID")
+    }
+    if deviceID == "" {
+        deviceID = newDeviceID()
+    } else if !deviceIDPattern.MatchString(deviceID) {
+        http.Error(w, "Invalid device ID", http.StatusBadRequest)
+        return
+    }
+
+    log.Printf("WebSocket: Attempting connection for user %d device %s", userID, deviceID)
 
     // Log request headers for debugging
     log.Printf("WebSocket: Request headers:")
@@ -44,12 +63,21 @@ func (h *Handlers) handleWebSocket(w http.ResponseWriter, r *http.Request) {
     log.Printf("WebSocket: Connection upgraded successfully for user %d", userID)
 
     // Create and register new client
-    client := newClient(userID, conn, h.hub)
+    client := newClient(userID, deviceID, conn, h.hub)
     h.hub.register <- client
 
-    log.Printf("WebSocket: Client %d registered with hub", userID)
+    log.Printf("WebSocket: Client %d/%s registered with hub", userID, deviceID)
 
     // Start client message pumps in separate goroutines
     go client.writePump()
     go client.readPump()
+
+    // Push everything that arrived while the user was offline
+    go client.replayPending()
+}
+
+func newDeviceID() string {
+    b := make([]byte, 8)
+    rand.Read(b)
+    return hex.EncodeToString(b)
 }
\ No newline at end of file
@@ -1,21 +1,225 @@
 package models
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 type User struct {
     ID        int64  `json:"id"`
     Username  string `json:"username"`
     Password  string `json:"-"` // Password hash, not exposed in JSON
     PublicKey []byte `json:"public_key"`
+    Role      string `json:"role,omitempty"`
+}
+
+// Presence is a user's online state as seen by another user
+type Presence struct {
+    UserID     int64      `json:"user_id"`
+    Status     string     `json:"status"`
+    LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// PrivacySettings control what other users can learn about a user
+type PrivacySettings struct {
+    PresenceVisibility string `json:"presence_visibility"`
+
+    // MessageRequests is VisibilityEveryone or VisibilityNobody and controls
+    // whether users who are not contacts may send contact requests
+    MessageRequests string `json:"message_requests"`
+}
+
+// Contact is an accepted contact of a user
+type Contact struct {
+    UserID   int64      `json:"user_id"`
+    Username string     `json:"username"`
+    Since    *time.Time `json:"since,omitempty"`
+}
+
+// ContactRequest asks AddresseeID to become a contact of RequesterID.
+// Username is the name of the other user from the viewer's side.
+type ContactRequest struct {
+    RequesterID int64     `json:"requester_id"`
+    AddresseeID int64     `json:"addressee_id"`
+    Username    string    `json:"username"`
+    Status      string    `json:"status"`
+    CreatedAt   time.Time `json:"created_at"`
+}
+
+// Prekey is a public key a device published for session setup. Signed
+// prekeys and one-time post-quantum prekeys carry the device identity key's
+// signature over the encoded key.
+type Prekey struct {
+    KeyID     int64  `json:"key_id"`
+    PublicKey []byte `json:"public_key"`
+    Signature []byte `json:"signature,omitempty"`
+}
+
+// DeviceKeys are the long-lived keys of one device
+type DeviceKeys struct {
+    UserID       int64     `json:"user_id"`
+    DeviceID     string    `json:"device_id"`
+    IdentityKey  []byte    `json:"identity_key"`
+    SignedPrekey Prekey    `json:"signed_prekey"`
+    UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// PrekeyBundle is what a peer needs to start a session with a device. The
+// one-time prekeys are missing once the device runs out.
+type PrekeyBundle struct {
+    DeviceID        string  `json:"device_id"`
+    IdentityKey     []byte  `json:"identity_key"`
+    SignedPrekey    Prekey  `json:"signed_prekey"`
+    PQPrekey        *Prekey `json:"pq_prekey,omitempty"`
+    ClassicalPrekey *Prekey `json:"classical_prekey,omitempty"`
+}
+
+// PrekeyCounts is how many unused one-time prekeys a device has left
+type PrekeyCounts struct {
+    PQ        int `json:"pq_prekeys"`
+    Classical int `json:"classical_prekeys"`
+}
+
+// UserKey is one of a user's account public keys and the interval it was
+// current in. The current key has no ValidUntil; LogIndex is its entry in
+// the key transparency log.
+type UserKey struct {
+    ID         int64      `json:"key_id"`
+    UserID     int64      `json:"user_id"`
+    PublicKey  []byte     `json:"public_key"`
+    LogIndex   *int64     `json:"log_index,omitempty"`
+    ValidFrom  time.Time  `json:"valid_from"`
+    ValidUntil *time.Time `json:"valid_until,omitempty"`
+}
+
+// KeyLogEntry is a leaf of the key transparency log. Data is the exact leaf
+// data clients hash.
+type KeyLogEntry struct {
+    Index     int64     `json:"index"`
+    Data      []byte    `json:"leaf_data"`
+    CreatedAt time.Time `json:"created_at"`
 }
 
 type Message struct {
-    ID         int64  `json:"id"`
-    SenderID   int64  `json:"sender_id"`
-    ReceiverID int64  `json:"receiver_id"`
-    Content    []byte `json:"content"`
-    Timestamp  int64  `json:"timestamp"`
-    Read       bool   `json:"read"`
+    ID              int64      `json:"id"`
+    ConversationID  int64      `json:"conversation_id"`
+    SenderID        int64      `json:"sender_id"`
+    ReceiverID      int64      `json:"receiver_id,omitempty"` // Only set for direct messages
+    ClientMessageID string     `json:"client_message_id,omitempty"`
+    Seq             int64      `json:"seq,omitempty"` // Position within the conversation
+    Type            string     `json:"type"`          // MessageTypeChat or MessageTypeSystem
+    ReplyToID       int64      `json:"reply_to_message_id,omitempty"` // Quoted message
+    ThreadRootID    int64      `json:"thread_root_id,omitempty"`      // Set on thread replies
+    Content         []byte     `json:"content"`
+    Timestamp       int64      `json:"timestamp"`
+    Read            bool       `json:"read"`
+    Version         int        `json:"version"`
+    EditedAt        *time.Time `json:"edited_at,omitempty"`
+    DeletedAt       *time.Time `json:"deleted_at,omitempty"` // Set on tombstones; their content is wiped
+    ExpiresAt       *time.Time `json:"expires_at,omitempty"` // Disappearing messages are removed after this
+    AttachmentIDs   []string   `json:"attachment_ids,omitempty"`
+
+    Reactions []*ReactionSummary `json:"reactions,omitempty"`
+}
+
+// ReactionSummary groups the reactions on a message. The server cannot group
+// encrypted reactions, so each of them gets its own entry.
+type ReactionSummary struct {
+    Emoji      string  `json:"emoji,omitempty"`
+    Ciphertext []byte  `json:"ciphertext,omitempty"`
+    Count      int     `json:"count"`
+    UserIDs    []int64 `json:"user_ids"`
+}
+
+// Thread summarizes the replies to a thread root message for one user
+type Thread struct {
+    Root        *Message `json:"root"`
+    ReplyCount  int      `json:"reply_count"`
+    UnreadCount int      `json:"unread_count"`
+    LastReplyID int64    `json:"last_reply_id"`
+    LastReplyAt int64    `json:"last_reply_at"`
+}
+
+// Attachment is an uploaded blob, addressed by the hex SHA-256 of its
+// client-encrypted content
+type Attachment struct {
+    ID        string    `json:"id"`
+    Size      int64     `json:"size"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// AttachmentUpload tracks a resumable upload into a conversation. Received
+// comes from the blob store; AttachmentID is set once the upload completed.
+type AttachmentUpload struct {
+    ID             string    `json:"upload_id"`
+    UserID         int64     `json:"user_id"`
+    ConversationID int64     `json:"conversation_id"`
+    Size           int64     `json:"size"`
+    Received       int64     `json:"received"`
+    AttachmentID   string    `json:"attachment_id,omitempty"`
+    CreatedAt      time.Time `json:"created_at"`
+}
+
+// ScheduledMessage is a chat frame waiting to be sent at SendAt. Message
+// holds the frame as submitted; MessageID is set once it was sent.
+type ScheduledMessage struct {
+    ID              int64           `json:"id"`
+    SenderID        int64           `json:"sender_id"`
+    ConversationID  int64           `json:"conversation_id"`
+    ClientMessageID string          `json:"client_message_id,omitempty"`
+    Message         json.RawMessage `json:"message"`
+    SendAt          time.Time       `json:"send_at"`
+    Status          string          `json:"status"`
+    MessageID       int64           `json:"message_id,omitempty"`
+    Error           string          `json:"error,omitempty"`
+    CreatedAt       time.Time       `json:"created_at"`
+}
+
+// MessageRevision is an earlier version of an edited message
+type MessageRevision struct {
+    MessageID int64     `json:"message_id"`
+    Version   int       `json:"version"`
+    Content   []byte    `json:"content"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// Receipt reports a delivery state change of one message for one recipient
+type Receipt struct {
+    MessageID      int64      `json:"message_id"`
+    ConversationID int64      `json:"conversation_id"`
+    SenderID       int64      `json:"sender_id"`
+    RecipientID    int64      `json:"recipient_id"`
+    Status         string     `json:"status"`
+    DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+    ReadAt         *time.Time `json:"read_at,omitempty"`
+}
+
+// ConversationHead is the newest sequence number of a conversation
+type ConversationHead struct {
+    ConversationID int64 `json:"conversation_id"`
+    LastSeq        int64 `json:"last_seq"`
+}
+
+type Conversation struct {
+    ID        int64                 `json:"id"`
+    Name      string                `json:"name,omitempty"`
+    IsGroup   bool                  `json:"is_group"`
+    CreatedBy int64                 `json:"created_by"`
+    CreatedAt time.Time             `json:"created_at"`
+    Members   []*ConversationMember `json:"members,omitempty"`
+
+    // MessageTTL is the lifetime in seconds of new messages; 0 keeps them
+    MessageTTL int `json:"message_ttl,omitempty"`
+
+    // E2ERequired conversations only take encrypted envelopes as content
+    E2ERequired bool `json:"e2e_required"`
+}
+
+type ConversationMember struct {
+    UserID   int64     `json:"user_id"`
+    Username string    `json:"username"`
+    Role     string    `json:"role"`
+    JoinedAt time.Time `json:"joined_at"`
 }
 
 type WSMessage struct {
@@ -27,6 +231,75 @@ type WSMessage struct {
 const (
     MessageTypeChat   = "chat"
     MessageTypeSystem = "system"
+
+    // Sealed sender messages have no sender_id; the sender is only named
+    // inside the encrypted content
+    MessageTypeSealed = "sealed"
+)
+
+// Message deletion scopes
+const (
+    DeleteForMe       = "me"
+    DeleteForEveryone = "everyone"
+)
+
+// Presence states
+const (
+    PresenceOnline  = "online"
+    PresenceOffline = "offline"
+)
+
+// Visibility levels for privacy settings
+const (
+    VisibilityEveryone = "everyone"
+    VisibilityContacts = "contacts"
+    VisibilityNobody   = "nobody"
+)
+
+// Contact request states
+const (
+    ContactPending  = "pending"
+    ContactAccepted = "accepted"
+    ContactDeclined = "declined"
+)
+
+// One-time prekey kinds. Post-quantum prekeys are hybrid X25519 +
+// ML-KEM-768 keys; classical ones are plain X25519 keys.
+const (
+    PrekeyPQ        = "pq"
+    PrekeyClassical = "classical"
+)
+
+// User roles; admins may send announcements
+const (
+    UserRoleUser  = "user"
+    UserRoleAdmin = "admin"
+)
+
+// Conversation member roles
+const (
+    RoleAdmin  = "admin"
+    RoleMember = "member"
+)
+
+// Per-recipient delivery states. A recipient's state only moves forward:
+// stored -> delivered (a device acked it) -> read. DeliverySent is what the
+// sender sees once the message is stored for every recipient.
+const (
+    DeliverySent      = "sent"
+    DeliveryStored    = "stored"
+    DeliveryDelivered = "delivered"
+    DeliveryRead      = "read"
+)
+
+// Scheduled message states. A scheduler instance claims a due message by
+// moving it to sending; it ends up sent, failed or, before that, cancelled.
+const (
+    ScheduledPending   = "pending"
+    ScheduledSending   = "sending"
+    ScheduledSent      = "sent"
+    ScheduledFailed    = "failed"
+    ScheduledCancelled = "cancelled"
 )
 
 // SQL migrations
@@ -37,21 +310,205 @@ const (
         username VARCHAR(255) UNIQUE NOT NULL,
         password VARCHAR(255) NOT NULL,
         public_key BYTEA NOT NULL,
+        last_seen_at TIMESTAMP WITH TIME ZONE,
+        presence_visibility VARCHAR(16) NOT NULL DEFAULT 'everyone',
+        message_requests VARCHAR(16) NOT NULL DEFAULT 'everyone',
+        role VARCHAR(16) NOT NULL DEFAULT 'user',
+        delivery_token_hash BYTEA,
         created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
     );
 
+    CREATE TABLE IF NOT EXISTS conversations (
+        id SERIAL PRIMARY KEY,
+        name VARCHAR(255),
+        is_group BOOLEAN NOT NULL DEFAULT FALSE,
+        direct_key VARCHAR(64) UNIQUE,
+        last_seq BIGINT NOT NULL DEFAULT 0,
+        message_ttl INTEGER,
+        e2e_required BOOLEAN NOT NULL DEFAULT FALSE,
+        created_by INTEGER REFERENCES users(id),
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    );
+
+    CREATE TABLE IF NOT EXISTS conversation_members (
+        conversation_id INTEGER REFERENCES conversations(id) ON DELETE CASCADE,
+        user_id INTEGER REFERENCES users(id),
+        role VARCHAR(16) NOT NULL DEFAULT 'member',
+        joined_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (conversation_id, user_id)
+    );
+
     CREATE TABLE IF NOT EXISTS messages (
         id SERIAL PRIMARY KEY,
+        conversation_id INTEGER REFERENCES conversations(id),
         sender_id INTEGER REFERENCES users(id),
         receiver_id INTEGER REFERENCES users(id),
+        client_message_id VARCHAR(64),
+        seq BIGINT,
+        type VARCHAR(16) NOT NULL DEFAULT 'chat',
+        reply_to_message_id INTEGER REFERENCES messages(id) ON DELETE SET NULL,
+        thread_root_id INTEGER REFERENCES messages(id) ON DELETE SET NULL,
         content BYTEA NOT NULL,
         timestamp BIGINT NOT NULL,
         read BOOLEAN DEFAULT FALSE,
-        created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+        version INTEGER NOT NULL DEFAULT 1,
+        edited_at TIMESTAMP WITH TIME ZONE,
+        deleted_at TIMESTAMP WITH TIME ZONE,
+        expires_at TIMESTAMP WITH TIME ZONE,
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE (sender_id, client_message_id),
+        UNIQUE (conversation_id, seq)
     );
 
     CREATE INDEX IF NOT EXISTS idx_messages_sender ON messages(sender_id);
     CREATE INDEX IF NOT EXISTS idx_messages_receiver ON messages(receiver_id);
     CREATE INDEX IF NOT EXISTS idx_messages_timestamp ON messages(timestamp);
+    CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages(conversation_id, id);
+    CREATE INDEX IF NOT EXISTS idx_messages_thread ON messages(thread_root_id, id);
+    CREATE INDEX IF NOT EXISTS idx_messages_expires ON messages(expires_at) WHERE expires_at IS NOT NULL;
+
+    CREATE TABLE IF NOT EXISTS message_recipients (
+        message_id INTEGER REFERENCES messages(id) ON DELETE CASCADE,
+        user_id INTEGER REFERENCES users(id),
+        status VARCHAR(16) NOT NULL DEFAULT 'stored',
+        delivered_at TIMESTAMP WITH TIME ZONE,
+        read_at TIMESTAMP WITH TIME ZONE,
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (message_id, user_id)
+    );
+
+    CREATE TABLE IF NOT EXISTS message_revisions (
+        message_id INTEGER REFERENCES messages(id) ON DELETE CASCADE,
+        version INTEGER NOT NULL,
+        content BYTEA NOT NULL,
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (message_id, version)
+    );
+
+    CREATE TABLE IF NOT EXISTS message_hidden (
+        message_id INTEGER REFERENCES messages(id) ON DELETE CASCADE,
+        user_id INTEGER REFERENCES users(id),
+        hidden_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (message_id, user_id)
+    );
+
+    CREATE TABLE IF NOT EXISTS reactions (
+        message_id INTEGER REFERENCES messages(id) ON DELETE CASCADE,
+        user_id INTEGER REFERENCES users(id),
+        reaction BYTEA NOT NULL,
+        encrypted BOOLEAN NOT NULL DEFAULT FALSE,
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (message_id, user_id)
+    );
+
+    CREATE TABLE IF NOT EXISTS attachments (
+        id VARCHAR(64) PRIMARY KEY,
+        size BIGINT NOT NULL,
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    );
+
+    CREATE TABLE IF NOT EXISTS attachment_links (
+        attachment_id VARCHAR(64) REFERENCES attachments(id),
+        conversation_id INTEGER REFERENCES conversations(id) ON DELETE CASCADE,
+        uploaded_by INTEGER REFERENCES users(id),
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (attachment_id, conversation_id)
+    );
+
+    CREATE TABLE IF NOT EXISTS attachment_uploads (
+        id VARCHAR(32) PRIMARY KEY,
+        user_id INTEGER REFERENCES users(id),
+        conversation_id INTEGER REFERENCES conversations(id) ON DELETE CASCADE,
+        size BIGINT NOT NULL,
+        attachment_id VARCHAR(64) REFERENCES attachments(id),
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    );
+
+    CREATE TABLE IF NOT EXISTS message_attachments (
+        message_id INTEGER REFERENCES messages(id) ON DELETE CASCADE,
+        attachment_id VARCHAR(64) REFERENCES attachments(id),
+        position INTEGER NOT NULL,
+        PRIMARY KEY (message_id, attachment_id)
+    );
+
+    CREATE TABLE IF NOT EXISTS scheduled_messages (
+        id SERIAL PRIMARY KEY,
+        sender_id INTEGER REFERENCES users(id),
+        conversation_id INTEGER REFERENCES conversations(id) ON DELETE CASCADE,
+        client_message_id VARCHAR(64),
+        frame JSON NOT NULL,
+        send_at TIMESTAMP WITH TIME ZONE NOT NULL,
+        status VARCHAR(16) NOT NULL DEFAULT 'pending',
+        claimed_at TIMESTAMP WITH TIME ZONE,
+        message_id INTEGER REFERENCES messages(id) ON DELETE SET NULL,
+        error TEXT,
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE (sender_id, client_message_id)
+    );
+
+    CREATE INDEX IF NOT EXISTS idx_scheduled_messages_due ON scheduled_messages(send_at) WHERE status IN ('pending', 'sending');
+
+    CREATE TABLE IF NOT EXISTS contact_requests (
+        requester_id INTEGER REFERENCES users(id),
+        addressee_id INTEGER REFERENCES users(id),
+        status VARCHAR(16) NOT NULL DEFAULT 'pending',
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        responded_at TIMESTAMP WITH TIME ZONE,
+        PRIMARY KEY (requester_id, addressee_id)
+    );
+
+    CREATE TABLE IF NOT EXISTS blocks (
+        user_id INTEGER REFERENCES users(id),
+        blocked_id INTEGER REFERENCES users(id),
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (user_id, blocked_id)
+    );
+
+    CREATE TABLE IF NOT EXISTS device_keys (
+        user_id INTEGER REFERENCES users(id),
+        device_id VARCHAR(64) NOT NULL,
+        identity_key BYTEA NOT NULL,
+        signed_prekey_id BIGINT NOT NULL,
+        signed_prekey BYTEA NOT NULL,
+        signed_prekey_signature BYTEA NOT NULL,
+        updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (user_id, device_id)
+    );
+
+    CREATE TABLE IF NOT EXISTS one_time_prekeys (
+        user_id INTEGER NOT NULL,
+        device_id VARCHAR(64) NOT NULL,
+        kind VARCHAR(16) NOT NULL,
+        key_id BIGINT NOT NULL,
+        public_key BYTEA NOT NULL,
+        signature BYTEA,
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (user_id, device_id, kind, key_id),
+        FOREIGN KEY (user_id, device_id) REFERENCES device_keys(user_id, device_id) ON DELETE CASCADE
+    );
+
+    CREATE TABLE IF NOT EXISTS user_keys (
+        id SERIAL PRIMARY KEY,
+        user_id INTEGER REFERENCES users(id),
+        public_key BYTEA NOT NULL,
+        log_index BIGINT,
+        valid_from TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        valid_until TIMESTAMP WITH TIME ZONE
+    );
+
+    CREATE TABLE IF NOT EXISTS key_log (
+        leaf_index BIGINT PRIMARY KEY,
+        user_id INTEGER NOT NULL,
+        key_type VARCHAR(16) NOT NULL,
+        device_id VARCHAR(64),
+        leaf_data BYTEA NOT NULL,
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    );
+
+    CREATE INDEX IF NOT EXISTS idx_conversation_members_user ON conversation_members(user_id);
+    CREATE INDEX IF NOT EXISTS idx_message_recipients_user ON message_recipients(user_id, status);
+    CREATE INDEX IF NOT EXISTS idx_contact_requests_addressee ON contact_requests(addressee_id, status);
+    CREATE INDEX IF NOT EXISTS idx_key_log_user ON key_log(user_id);
+    CREATE INDEX IF NOT EXISTS idx_user_keys_user ON user_keys(user_id, valid_from);
     `
 )
\ No newline at end of file
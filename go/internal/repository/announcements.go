@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"quantum-chat/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// GetAudienceUserIDs resolves the users an announcement goes to: the given
+// users if any, else every user with the role if set, else every user
+func (d *Database) GetAudienceUserIDs(userIDs []int64, role string) ([]int64, error) {
+    query := `SELECT id FROM users ORDER BY id`
+    var args []interface{}
+    switch {
+    case len(userIDs) > 0:
+        query = `SELECT id FROM users WHERE id = ANY($1) ORDER BY id`
+        args = append(args, pq.Array(userIDs))
+    case role != "":
+        query = `SELECT id FROM users WHERE role = $1 ORDER BY id`
+        args = append(args, role)
+    }
+
+    rows, err := d.db.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var ids []int64
+    for rows.Next() {
+        var id int64
+        if err := rows.Scan(&id); err != nil {
+            return nil, err
+        }
+        ids = append(ids, id)
+    }
+    return ids, rows.Err()
+}
+
+// SaveSystemMessage stores a system message, such as an announcement,
+// outside any conversation with a pending delivery row per recipient, so
+// offline recipients get it replayed on their next connect. System messages
+// have no sender, so nobody can edit or delete them; whoever caused one is
+// named in its content.
+func (d *Database) SaveSystemMessage(msg *models.Message, recipientIDs []int64) error {
+    tx, err := d.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    err = tx.QueryRow(`
+        INSERT INTO messages (type, content, timestamp)
+        VALUES ($1, $2, $3)
+        RETURNING id, version`,
+        models.MessageTypeSystem, msg.Content, msg.Timestamp,
+    ).Scan(&msg.ID, &msg.Version)
+    if err != nil {
+        return err
+    }
+    msg.SenderID = 0
+    msg.Type = models.MessageTypeSystem
+
+    _, err = tx.Exec(`
+        INSERT INTO message_recipients (message_id, user_id, status)
+        SELECT $1, unnest($2::int[]), $3`,
+        msg.ID, pq.Array(recipientIDs), models.DeliveryStored)
+    if err != nil {
+        return err
+    }
+    return tx.Commit()
+}
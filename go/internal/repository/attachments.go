@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"database/sql"
+	"quantum-chat/internal/models"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func (d *Database) CreateUpload(upload *models.AttachmentUpload) error {
+    return d.db.QueryRow(`
+        INSERT INTO attachment_uploads (id, user_id, conversation_id, size)
+        VALUES ($1, $2, $3, $4)
+        RETURNING created_at`,
+        upload.ID, upload.UserID, upload.ConversationID, upload.Size,
+    ).Scan(&upload.CreatedAt)
+}
+
+// GetUpload returns nil if the upload does not exist
+func (d *Database) GetUpload(id string) (*models.AttachmentUpload, error) {
+    upload := &models.AttachmentUpload{}
+    err := d.db.QueryRow(`
+        SELECT id, user_id, conversation_id, size, COALESCE(attachment_id, ''), created_at
+        FROM attachment_uploads
+        WHERE id = $1`, id,
+    ).Scan(
+        &upload.ID,
+        &upload.UserID,
+        &upload.ConversationID,
+        &upload.Size,
+        &upload.AttachmentID,
+        &upload.CreatedAt,
+    )
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    return upload, err
+}
+
+// CompleteUpload records the committed blob of an upload and makes it
+// available in the upload's conversation
+func (d *Database) CompleteUpload(upload *models.AttachmentUpload, attachmentID string, size int64) (*models.Attachment, error) {
+    tx, err := d.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    _, err = tx.Exec(`
+        INSERT INTO attachments (id, size)
+        VALUES ($1, $2)
+        ON CONFLICT (id) DO NOTHING`,
+        attachmentID, size)
+    if err != nil {
+        return nil, err
+    }
+
+    _, err = tx.Exec(`
+        INSERT INTO attachment_links (attachment_id, conversation_id, uploaded_by)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (attachment_id, conversation_id) DO UPDATE SET created_at = CURRENT_TIMESTAMP`,
+        attachmentID, upload.ConversationID, upload.UserID)
+    if err != nil {
+        return nil, err
+    }
+
+    _, err = tx.Exec(`UPDATE attachment_uploads SET attachment_id = $1 WHERE id = $2`, attachmentID, upload.ID)
+    if err != nil {
+        return nil, err
+    }
+
+    attachment := &models.Attachment{}
+    err = tx.QueryRow(`SELECT id, size, created_at FROM attachments WHERE id = $1`, attachmentID).Scan(
+        &attachment.ID,
+        &attachment.Size,
+        &attachment.CreatedAt,
+    )
+    if err != nil {
+        return nil, err
+    }
+    upload.AttachmentID = attachmentID
+    return attachment, tx.Commit()
+}
+
+func (d *Database) DeleteUpload(id string) error {
+    _, err := d.db.Exec(`DELETE FROM attachment_uploads WHERE id = $1`, id)
+    return err
+}
+
+// GetAttachment returns nil if the attachment does not exist
+func (d *Database) GetAttachment(id string) (*models.Attachment, error) {
+    attachment := &models.Attachment{}
+    err := d.db.QueryRow(`SELECT id, size, created_at FROM attachments WHERE id = $1`, id).Scan(
+        &attachment.ID,
+        &attachment.Size,
+        &attachment.CreatedAt,
+    )
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    return attachment, err
+}
+
+// CanAccessAttachment reports whether the attachment is referenced by a
+// message the user sent or received that was not deleted and has not
+// expired by now
+func (d *Database) CanAccessAttachment(attachmentID string, userID int64, now time.Time) (bool, error) {
+    var ok bool
+    err := d.db.QueryRow(`
+        SELECT EXISTS (
+            SELECT 1
+            FROM message_attachments a
+            JOIN messages m ON m.id = a.message_id
+            WHERE a.attachment_id = $1
+              AND m.deleted_at IS NULL
+              AND `+notExpired("$3")+`
+              AND (m.sender_id = $2 OR EXISTS (
+                SELECT 1 FROM message_recipients r
+                WHERE r.message_id = m.id AND r.user_id = $2)))`,
+        attachmentID, userID, now,
+    ).Scan(&ok)
+    return ok, err
+}
+
+// DeleteOrphanedAttachments deletes up to limit attachments that no message
+// references and that were last uploaded before the given time, and returns
+// their IDs so their blobs can be removed. Attachments named by a scheduled
+// message that is still to be sent are kept.
+func (d *Database) DeleteOrphanedAttachments(before time.Time, limit int) ([]string, error) {
+    tx, err := d.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    rows, err := tx.Query(`
+        SELECT a.id
+        FROM attachments a
+        WHERE a.created_at <= $1
+          AND NOT EXISTS (
+            SELECT 1 FROM message_attachments m WHERE m.attachment_id = a.id)
+          AND NOT EXISTS (
+            SELECT 1 FROM attachment_links l WHERE l.attachment_id = a.id AND l.created_at > $1)
+          AND NOT EXISTS (
+            SELECT 1 FROM scheduled_messages s
+            WHERE s.status IN ($2, $3) AND s.frame::jsonb -> 'attachment_ids' ? a.id)
+        ORDER BY a.created_at
+        LIMIT $4
+        FOR UPDATE SKIP LOCKED`,
+        before, models.ScheduledPending, models.ScheduledSending, limit)
+    if err != nil {
+        return nil, err
+    }
+    var ids []string
+    for rows.Next() {
+        var id string
+        if err := rows.Scan(&id); err != nil {
+            rows.Close()
+            return nil, err
+        }
+        ids = append(ids, id)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+    if len(ids) == 0 {
+        return nil, nil
+    }
+
+    for _, query := range []string{
+        `DELETE FROM attachment_links WHERE attachment_id = ANY($1)`,
+        `DELETE FROM attachment_uploads WHERE attachment_id = ANY($1)`,
+        `DELETE FROM attachments WHERE id = ANY($1)`,
+    } {
+        if _, err := tx.Exec(query, pq.Array(ids)); err != nil {
+            return nil, err
+        }
+    }
+    return ids, tx.Commit()
+}
+
+// CountConversationAttachments reports how many of the given attachments were
+// uploaded to the conversation
+func (d *Database) CountConversationAttachments(convID int64, attachmentIDs []string) (int, error) {
+    var count int
+    err := d.db.QueryRow(`
+        SELECT COUNT(*)
+        FROM attachment_links
+        WHERE conversation_id = $1 AND attachment_id = ANY($2)`,
+        convID, pq.Array(attachmentIDs),
+    ).Scan(&count)
+    return count, err
+}
@@ -0,0 +1,291 @@
+package repository
+
+import (
+	"database/sql"
+	"quantum-chat/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// GetContacts lists the user's accepted contacts. Two users are contacts
+// once either accepted a request from the other.
+func (d *Database) GetContacts(userID int64) ([]*models.Contact, error) {
+    rows, err := d.db.Query(`
+        SELECT u.id, u.username, c.responded_at
+        FROM contact_requests c
+        JOIN users u ON u.id = CASE WHEN c.requester_id = $1 THEN c.addressee_id ELSE c.requester_id END
+        WHERE (c.requester_id = $1 OR c.addressee_id = $1) AND c.status = $2
+        ORDER BY u.username`,
+        userID, models.ContactAccepted)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var contacts []*models.Contact
+    for rows.Next() {
+        contact := &models.Contact{}
+        if err := rows.Scan(&contact.UserID, &contact.Username, &contact.Since); err != nil {
+            return nil, err
+        }
+        contacts = append(contacts, contact)
+    }
+    return contacts, rows.Err()
+}
+
+// GetContactIDs returns the user IDs of the user's accepted contacts
+func (d *Database) GetContactIDs(userID int64) ([]int64, error) {
+    rows, err := d.db.Query(`
+        SELECT CASE WHEN requester_id = $1 THEN addressee_id ELSE requester_id END
+        FROM contact_requests
+        WHERE (requester_id = $1 OR addressee_id = $1) AND status = $2`,
+        userID, models.ContactAccepted)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var ids []int64
+    for rows.Next() {
+        var id int64
+        if err := rows.Scan(&id); err != nil {
+            return nil, err
+        }
+        ids = append(ids, id)
+    }
+    return ids, rows.Err()
+}
+
+// IsContact reports whether two users accepted each other as contacts
+func (d *Database) IsContact(userID, otherID int64) (bool, error) {
+    var ok bool
+    err := d.db.QueryRow(`
+        SELECT EXISTS (
+            SELECT 1 FROM contact_requests
+            WHERE ((requester_id = $1 AND addressee_id = $2) OR (requester_id = $2 AND addressee_id = $1))
+              AND status = $3)`,
+        userID, otherID, models.ContactAccepted,
+    ).Scan(&ok)
+    return ok, err
+}
+
+// GetPendingContactRequests lists the pending requests sent to and by the user
+func (d *Database) GetPendingContactRequests(userID int64) ([]*models.ContactRequest, error) {
+    rows, err := d.db.Query(`
+        SELECT c.requester_id, c.addressee_id, u.username, c.status, c.created_at
+        FROM contact_requests c
+        JOIN users u ON u.id = CASE WHEN c.requester_id = $1 THEN c.addressee_id ELSE c.requester_id END
+        WHERE (c.requester_id = $1 OR c.addressee_id = $1) AND c.status = $2
+        ORDER BY c.created_at DESC`,
+        userID, models.ContactPending)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var requests []*models.ContactRequest
+    for rows.Next() {
+        req := &models.ContactRequest{}
+        if err := rows.Scan(&req.RequesterID, &req.AddresseeID, &req.Username, &req.Status, &req.CreatedAt); err != nil {
+            return nil, err
+        }
+        requests = append(requests, req)
+    }
+    return requests, rows.Err()
+}
+
+// GetContactRequest returns nil if requesterID never asked addresseeID
+func (d *Database) GetContactRequest(requesterID, addresseeID int64) (*models.ContactRequest, error) {
+    req := &models.ContactRequest{}
+    err := d.db.QueryRow(`
+        SELECT c.requester_id, c.addressee_id, u.username, c.status, c.created_at
+        FROM contact_requests c
+        JOIN users u ON u.id = c.addressee_id
+        WHERE c.requester_id = $1 AND c.addressee_id = $2`,
+        requesterID, addresseeID,
+    ).Scan(&req.RequesterID, &req.AddresseeID, &req.Username, &req.Status, &req.CreatedAt)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    return req, err
+}
+
+// CreateContactRequest stores a pending request. An earlier request between
+// the same users in the same direction is kept as it is, so a declined
+// request cannot be repeated.
+func (d *Database) CreateContactRequest(requesterID, addresseeID int64) (created bool, err error) {
+    result, err := d.db.Exec(`
+        INSERT INTO contact_requests (requester_id, addressee_id, status)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (requester_id, addressee_id) DO NOTHING`,
+        requesterID, addresseeID, models.ContactPending)
+    if err != nil {
+        return false, err
+    }
+    n, err := result.RowsAffected()
+    return n > 0, err
+}
+
+// RespondContactRequest accepts or declines a pending request and reports
+// whether there was one
+func (d *Database) RespondContactRequest(requesterID, addresseeID int64, status string) (bool, error) {
+    result, err := d.db.Exec(`
+        UPDATE contact_requests
+        SET status = $3, responded_at = CURRENT_TIMESTAMP
+        WHERE requester_id = $1 AND addressee_id = $2 AND status = $4`,
+        requesterID, addresseeID, status, models.ContactPending)
+    if err != nil {
+        return false, err
+    }
+    n, err := result.RowsAffected()
+    return n > 0, err
+}
+
+// RemoveContact forgets every request between two users and reports whether
+// they were contacts
+func (d *Database) RemoveContact(userID, otherID int64) (bool, error) {
+    result, err := d.db.Exec(`
+        DELETE FROM contact_requests
+        WHERE ((requester_id = $1 AND addressee_id = $2) OR (requester_id = $2 AND addressee_id = $1))
+          AND status = $3`,
+        userID, otherID, models.ContactAccepted)
+    if err != nil {
+        return false, err
+    }
+    n, err := result.RowsAffected()
+    return n > 0, err
+}
+
+// BlockUser blocks a user and drops any contact or request between the two.
+// The blocked user's side is kept as a declined request, so unblocking them
+// later does not let them ask again.
+func (d *Database) BlockUser(userID, blockedID int64) error {
+    tx, err := d.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    _, err = tx.Exec(`
+        INSERT INTO blocks (user_id, blocked_id)
+        VALUES ($1, $2)
+        ON CONFLICT (user_id, blocked_id) DO NOTHING`,
+        userID, blockedID)
+    if err != nil {
+        return err
+    }
+
+    _, err = tx.Exec(`
+        DELETE FROM contact_requests
+        WHERE requester_id = $1 AND addressee_id = $2`,
+        userID, blockedID)
+    if err != nil {
+        return err
+    }
+
+    _, err = tx.Exec(`
+        INSERT INTO contact_requests (requester_id, addressee_id, status, responded_at)
+        VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+        ON CONFLICT (requester_id, addressee_id)
+        DO UPDATE SET status = EXCLUDED.status, responded_at = EXCLUDED.responded_at`,
+        blockedID, userID, models.ContactDeclined)
+    if err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+
+// UnblockUser reports whether the user was blocked
+func (d *Database) UnblockUser(userID, blockedID int64) (bool, error) {
+    result, err := d.db.Exec(`DELETE FROM blocks WHERE user_id = $1 AND blocked_id = $2`, userID, blockedID)
+    if err != nil {
+        return false, err
+    }
+    n, err := result.RowsAffected()
+    return n > 0, err
+}
+
+// GetBlockedUsers lists the users the user blocked, newest first
+func (d *Database) GetBlockedUsers(userID int64) ([]*models.Contact, error) {
+    rows, err := d.db.Query(`
+        SELECT u.id, u.username, b.created_at
+        FROM blocks b
+        JOIN users u ON u.id = b.blocked_id
+        WHERE b.user_id = $1
+        ORDER BY b.created_at DESC`,
+        userID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var blocked []*models.Contact
+    for rows.Next() {
+        user := &models.Contact{}
+        if err := rows.Scan(&user.UserID, &user.Username, &user.Since); err != nil {
+            return nil, err
+        }
+        blocked = append(blocked, user)
+    }
+    return blocked, rows.Err()
+}
+
+// IsBlocked reports whether either user blocked the other
+func (d *Database) IsBlocked(userID, otherID int64) (bool, error) {
+    var blocked bool
+    err := d.db.QueryRow(`
+        SELECT EXISTS (
+            SELECT 1 FROM blocks
+            WHERE (user_id = $1 AND blocked_id = $2) OR (user_id = $2 AND blocked_id = $1))`,
+        userID, otherID,
+    ).Scan(&blocked)
+    return blocked, err
+}
+
+// GetBlockerIDs returns which of the given users blocked userID
+func (d *Database) GetBlockerIDs(userID int64, candidateIDs []int64) ([]int64, error) {
+    rows, err := d.db.Query(`
+        SELECT user_id FROM blocks
+        WHERE blocked_id = $1 AND user_id = ANY($2)`,
+        userID, pq.Array(candidateIDs))
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var ids []int64
+    for rows.Next() {
+        var id int64
+        if err := rows.Scan(&id); err != nil {
+            return nil, err
+        }
+        ids = append(ids, id)
+    }
+    return ids, rows.Err()
+}
+
+// GetBlockedEitherWay returns which of the given users blocked userID or
+// were blocked by them
+func (d *Database) GetBlockedEitherWay(userID int64, candidateIDs []int64) ([]int64, error) {
+    rows, err := d.db.Query(`
+        SELECT user_id FROM blocks
+        WHERE blocked_id = $1 AND user_id = ANY($2)
+        UNION
+        SELECT blocked_id FROM blocks
+        WHERE user_id = $1 AND blocked_id = ANY($2)`,
+        userID, pq.Array(candidateIDs))
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var ids []int64
+    for rows.Next() {
+        var id int64
+        if err := rows.Scan(&id); err != nil {
+            return nil, err
+        }
+        ids = append(ids, id)
+    }
+    return ids, rows.Err()
+}
@@ -0,0 +1,265 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"quantum-chat/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// CreateConversation creates a group conversation with its creator as admin
+func (d *Database) CreateConversation(conv *models.Conversation, memberIDs []int64) error {
+    tx, err := d.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    query := `
+        INSERT INTO conversations (name, is_group, created_by)
+        VALUES ($1, TRUE, $2)
+        RETURNING id, created_at`
+
+    if err := tx.QueryRow(query, conv.Name, conv.CreatedBy).Scan(&conv.ID, &conv.CreatedAt); err != nil {
+        return err
+    }
+    conv.IsGroup = true
+
+    if err := addMembers(tx, conv.ID, []int64{conv.CreatedBy}, models.RoleAdmin); err != nil {
+        return err
+    }
+    if err := addMembers(tx, conv.ID, memberIDs, models.RoleMember); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// GetOrCreateDirectConversation returns the one-to-one conversation between two users
+func (d *Database) GetOrCreateDirectConversation(userID, peerID int64) (int64, error) {
+    low, high := userID, peerID
+    if low > high {
+        low, high = high, low
+    }
+    directKey := fmt.Sprintf("%d:%d", low, high)
+
+    tx, err := d.db.Begin()
+    if err != nil {
+        return 0, err
+    }
+    defer tx.Rollback()
+
+    var convID int64
+    err = tx.QueryRow(`
+        INSERT INTO conversations (is_group, direct_key, created_by)
+        VALUES (FALSE, $1, $2)
+        ON CONFLICT (direct_key) DO NOTHING
+        RETURNING id`,
+        directKey, userID,
+    ).Scan(&convID)
+    if err == sql.ErrNoRows {
+        err = tx.QueryRow(`SELECT id FROM conversations WHERE direct_key = $1`, directKey).Scan(&convID)
+    }
+    if err != nil {
+        return 0, err
+    }
+
+    if err := addMembers(tx, convID, []int64{low, high}, models.RoleMember); err != nil {
+        return 0, err
+    }
+
+    return convID, tx.Commit()
+}
+
+func (d *Database) GetConversation(id int64) (*models.Conversation, error) {
+    conv := &models.Conversation{}
+    query := `
+        SELECT id, COALESCE(name, ''), is_group, COALESCE(created_by, 0), created_at, COALESCE(message_ttl, 0), e2e_required
+        FROM conversations
+        WHERE id = $1`
+
+    err := d.db.QueryRow(query, id).Scan(
+        &conv.ID,
+        &conv.Name,
+        &conv.IsGroup,
+        &conv.CreatedBy,
+        &conv.CreatedAt,
+        &conv.MessageTTL,
+        &conv.E2ERequired,
+    )
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    conv.Members, err = d.GetConversationMembers(id)
+    if err != nil {
+        return nil, err
+    }
+    return conv, nil
+}
+
+// GetUserConversations lists every conversation the user is a member of
+func (d *Database) GetUserConversations(userID int64) ([]*models.Conversation, error) {
+    query := `
+        SELECT c.id, COALESCE(c.name, ''), c.is_group, COALESCE(c.created_by, 0), c.created_at,
+               COALESCE(c.message_ttl, 0), c.e2e_required
+        FROM conversations c
+        JOIN conversation_members m ON m.conversation_id = c.id
+        WHERE m.user_id = $1
+        ORDER BY c.id`
+
+    rows, err := d.db.Query(query, userID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var conversations []*models.Conversation
+    for rows.Next() {
+        conv := &models.Conversation{}
+        err := rows.Scan(
+            &conv.ID,
+            &conv.Name,
+            &conv.IsGroup,
+            &conv.CreatedBy,
+            &conv.CreatedAt,
+            &conv.MessageTTL,
+            &conv.E2ERequired,
+        )
+        if err != nil {
+            return nil, err
+        }
+        conversations = append(conversations, conv)
+    }
+    return conversations, rows.Err()
+}
+
+func (d *Database) GetConversationMembers(convID int64) ([]*models.ConversationMember, error) {
+    query := `
+        SELECT m.user_id, u.username, m.role, m.joined_at
+        FROM conversation_members m
+        JOIN users u ON u.id = m.user_id
+        WHERE m.conversation_id = $1
+        ORDER BY m.joined_at, m.user_id`
+
+    rows, err := d.db.Query(query, convID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var members []*models.ConversationMember
+    for rows.Next() {
+        member := &models.ConversationMember{}
+        if err := rows.Scan(&member.UserID, &member.Username, &member.Role, &member.JoinedAt); err != nil {
+            return nil, err
+        }
+        members = append(members, member)
+    }
+    return members, rows.Err()
+}
+
+// GetConversationMemberIDs returns the user IDs of all members, used for fan-out
+func (d *Database) GetConversationMemberIDs(convID int64) ([]int64, error) {
+    rows, err := d.db.Query(`SELECT user_id FROM conversation_members WHERE conversation_id = $1`, convID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var ids []int64
+    for rows.Next() {
+        var id int64
+        if err := rows.Scan(&id); err != nil {
+            return nil, err
+        }
+        ids = append(ids, id)
+    }
+    return ids, rows.Err()
+}
+
+// GetConversationMember returns nil if the user is not a member
+func (d *Database) GetConversationMember(convID, userID int64) (*models.ConversationMember, error) {
+    member := &models.ConversationMember{}
+    query := `
+        SELECT m.user_id, u.username, m.role, m.joined_at
+        FROM conversation_members m
+        JOIN users u ON u.id = m.user_id
+        WHERE m.conversation_id = $1 AND m.user_id = $2`
+
+    err := d.db.QueryRow(query, convID, userID).Scan(
+        &member.UserID,
+        &member.Username,
+        &member.Role,
+        &member.JoinedAt,
+    )
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    return member, err
+}
+
+func (d *Database) AddConversationMembers(convID int64, userIDs []int64) error {
+    tx, err := d.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if err := addMembers(tx, convID, userIDs, models.RoleMember); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+
+func (d *Database) RemoveConversationMember(convID, userID int64) error {
+    _, err := d.db.Exec(`
+        DELETE FROM conversation_members
+        WHERE conversation_id = $1 AND user_id = $2`,
+        convID, userID)
+    return err
+}
+
+func (d *Database) RenameConversation(convID int64, name string) error {
+    _, err := d.db.Exec(`UPDATE conversations SET name = $1 WHERE id = $2`, name, convID)
+    return err
+}
+
+// SetMessageTTL sets the lifetime of new messages in seconds; 0 turns
+// disappearing messages off
+func (d *Database) SetMessageTTL(convID int64, ttl int) error {
+    _, err := d.db.Exec(`UPDATE conversations SET message_ttl = $1 WHERE id = $2`, nullInt64(int64(ttl)), convID)
+    return err
+}
+
+// SetE2ERequired sets whether the conversation only takes encrypted
+// envelopes
+func (d *Database) SetE2ERequired(convID int64, required bool) error {
+    _, err := d.db.Exec(`UPDATE conversations SET e2e_required = $1 WHERE id = $2`, required, convID)
+    return err
+}
+
+// CountExistingUsers reports how many of the given IDs belong to real users
+func (d *Database) CountExistingUsers(userIDs []int64) (int, error) {
+    var count int
+    err := d.db.QueryRow(`SELECT COUNT(*) FROM users WHERE id = ANY($1)`, pq.Array(userIDs)).Scan(&count)
+    return count, err
+}
+
+func addMembers(tx *sql.Tx, convID int64, userIDs []int64, role string) error {
+    for _, userID := range userIDs {
+        _, err := tx.Exec(`
+            INSERT INTO conversation_members (conversation_id, user_id, role)
+            VALUES ($1, $2, $3)
+            ON CONFLICT (conversation_id, user_id) DO NOTHING`,
+            convID, userID, role)
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"quantum-chat/internal/models"
+)
+
+// DeleteMessageForEveryone turns a message sent by senderID into a tombstone:
+// its content is wiped and its revisions, reactions and attachment references
+// are dropped. It returns nil if the sender has no such message.
+func (d *Database) DeleteMessageForEveryone(messageID, senderID int64) (*models.Message, error) {
+    tx, err := d.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    msg, err := scanMessage(tx.QueryRow(`
+        UPDATE messages m
+        SET content = ''::bytea, deleted_at = COALESCE(m.deleted_at, CURRENT_TIMESTAMP)
+        WHERE m.id = $1 AND m.sender_id = $2 AND m.type <> $3
+        RETURNING `+messageColumns,
+        messageID, senderID, models.MessageTypeSystem))
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    if _, err := tx.Exec(`DELETE FROM message_revisions WHERE message_id = $1`, messageID); err != nil {
+        return nil, err
+    }
+    if _, err := tx.Exec(`DELETE FROM reactions WHERE message_id = $1`, messageID); err != nil {
+        return nil, err
+    }
+    if _, err := tx.Exec(`DELETE FROM message_attachments WHERE message_id = $1`, messageID); err != nil {
+        return nil, err
+    }
+    msg.AttachmentIDs = nil
+
+    return msg, tx.Commit()
+}
+
+// HideMessage removes a message from one user's history only
+func (d *Database) HideMessage(messageID, userID int64) error {
+    _, err := d.db.Exec(`
+        INSERT INTO message_hidden (message_id, user_id)
+        VALUES ($1, $2)
+        ON CONFLICT (message_id, user_id) DO NOTHING`,
+        messageID, userID)
+    return err
+}
+
+// notHiddenFrom is a filter on messages m excluding messages the user given by
+// the userParam placeholder deleted for themselves
+func notHiddenFrom(userParam string) string {
+    return fmt.Sprintf(`NOT EXISTS (
+            SELECT 1 FROM message_hidden h
+            WHERE h.message_id = m.id AND h.user_id = %s)`, userParam)
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ExpiredMessage identifies a reaped message and who had a copy of it
+type ExpiredMessage struct {
+    ID             int64
+    ConversationID int64
+    SenderID       int64
+    RecipientIDs   []int64
+}
+
+// DeleteExpiredMessages hard-deletes up to limit messages whose expiry is at
+// or before now, oldest expiry first. Rows locked by another instance's
+// reaper are skipped, so concurrent reapers never report the same message.
+func (d *Database) DeleteExpiredMessages(now time.Time, limit int) ([]*ExpiredMessage, error) {
+    tx, err := d.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    rows, err := tx.Query(`
+        SELECT id, COALESCE(conversation_id, 0), COALESCE(sender_id, 0)
+        FROM messages
+        WHERE expires_at <= $1
+        ORDER BY expires_at
+        LIMIT $2
+        FOR UPDATE SKIP LOCKED`,
+        now, limit)
+    if err != nil {
+        return nil, err
+    }
+
+    var expired []*ExpiredMessage
+    byID := make(map[int64]*ExpiredMessage)
+    var ids []int64
+    for rows.Next() {
+        msg := &ExpiredMessage{}
+        if err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.SenderID); err != nil {
+            rows.Close()
+            return nil, err
+        }
+        expired = append(expired, msg)
+        byID[msg.ID] = msg
+        ids = append(ids, msg.ID)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+    if len(ids) == 0 {
+        return nil, nil
+    }
+
+    rows, err = tx.Query(`
+        SELECT message_id, user_id
+        FROM message_recipients
+        WHERE message_id = ANY($1)`,
+        pq.Array(ids))
+    if err != nil {
+        return nil, err
+    }
+    for rows.Next() {
+        var messageID, userID int64
+        if err := rows.Scan(&messageID, &userID); err != nil {
+            rows.Close()
+            return nil, err
+        }
+        byID[messageID].RecipientIDs = append(byID[messageID].RecipientIDs, userID)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    // Recipients, revisions, reactions and hides go with the message
+    if _, err := tx.Exec(`DELETE FROM messages WHERE id = ANY($1)`, pq.Array(ids)); err != nil {
+        return nil, err
+    }
+    return expired, tx.Commit()
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"quantum-chat/internal/models"
+	"testing"
+	"time"
+)
+
+// testDatabase connects to the database in TEST_DATABASE_URL and creates
+// the schema; tests that need one are skipped without it
+func testDatabase(t *testing.T) *Database {
+    t.Helper()
+    url := os.Getenv("TEST_DATABASE_URL")
+    if url == "" {
+        t.Skip("TEST_DATABASE_URL is not set")
+    }
+
+    db, err := sql.Open("postgres", url)
+    if err != nil {
+        t.Fatalf("open database: %v", err)
+    }
+    t.Cleanup(func() { db.Close() })
+    if _, err := db.Exec(models.CreateTablesSQL); err != nil {
+        t.Fatalf("create tables: %v", err)
+    }
+    return &Database{db: db}
+}
+
+func createTestUser(t *testing.T, d *Database, name string) int64 {
+    t.Helper()
+    var id int64
+    err := d.db.QueryRow(`
+        INSERT INTO users (username, password, public_key)
+        VALUES ($1, 'x', '\x00')
+        RETURNING id`,
+        fmt.Sprintf("%s-%d", name, time.Now().UnixNano()),
+    ).Scan(&id)
+    if err != nil {
+        t.Fatalf("create user: %v", err)
+    }
+    return id
+}
+
+func containsMessage(messages []*models.Message, id int64) bool {
+    for _, msg := range messages {
+        if msg.ID == id {
+            return true
+        }
+    }
+    return false
+}
+
+// TestExpiryFollowsCallerClock drives reads and the reaper with the same
+// explicit times, far from the database's own clock, and checks they agree
+// on when a message is gone
+func TestExpiryFollowsCallerClock(t *testing.T) {
+    d := testDatabase(t)
+    senderID := createTestUser(t, d, "expiry-sender")
+    receiverID := createTestUser(t, d, "expiry-receiver")
+
+    now := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+    expiresAt := now.Add(time.Minute)
+    msg := &models.Message{
+        SenderID:   senderID,
+        ReceiverID: receiverID,
+        Content:    []byte(`"secret"`),
+        Timestamp:  now.Unix(),
+        ExpiresAt:  &expiresAt,
+    }
+    if _, err := d.SaveMessage(msg, []int64{receiverID}); err != nil {
+        t.Fatalf("save message: %v", err)
+    }
+
+    visible := func(at time.Time) (history, pending bool) {
+        t.Helper()
+        messages, err := d.GetMessages(MessageQuery{UserID: receiverID, PeerID: senderID, Limit: 10, Now: at})
+        if err != nil {
+            t.Fatalf("get messages: %v", err)
+        }
+        queued, err := d.GetPendingMessages(receiverID, 0, 10, at)
+        if err != nil {
+            t.Fatalf("get pending messages: %v", err)
+        }
+        return containsMessage(messages, msg.ID), containsMessage(queued, msg.ID)
+    }
+
+    if history, pending := visible(now); !history || !pending {
+        t.Fatalf("before expiry: history %v, pending %v; want both", history, pending)
+    }
+    expired, err := d.DeleteExpiredMessages(now, 1000)
+    if err != nil {
+        t.Fatalf("reap before expiry: %v", err)
+    }
+    for _, e := range expired {
+        if e.ID == msg.ID {
+            t.Fatal("message reaped before its expiry")
+        }
+    }
+
+    later := expiresAt
+    if history, pending := visible(later); history || pending {
+        t.Fatalf("at expiry: history %v, pending %v; want neither", history, pending)
+    }
+    expired, err = d.DeleteExpiredMessages(later, 1000)
+    if err != nil {
+        t.Fatalf("reap at expiry: %v", err)
+    }
+    var reaped *ExpiredMessage
+    for _, e := range expired {
+        if e.ID == msg.ID {
+            reaped = e
+        }
+    }
+    if reaped == nil {
+        t.Fatal("message not reaped at its expiry")
+    }
+    if reaped.SenderID != senderID || len(reaped.RecipientIDs) != 1 || reaped.RecipientIDs[0] != receiverID {
+        t.Fatalf("reaped %+v, want sender %d and recipient %d", reaped, senderID, receiverID)
+    }
+
+    gone, err := d.GetMessage(msg.ID)
+    if err != nil || gone != nil {
+        t.Fatalf("get reaped message = %v, %v; want nothing", gone, err)
+    }
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"database/sql"
+	"quantum-chat/internal/models"
+	"quantum-chat/internal/transparency"
+	"time"
+)
+
+// appendKeyLog adds an entry to the key transparency log inside the
+// transaction that publishes the key. The log is append-only and its leaf
+// indexes have no gaps: the table lock makes appends take turns and commit
+// in index order. It returns the entry's leaf index.
+func appendKeyLog(tx *sql.Tx, entry *transparency.Entry) (int64, error) {
+    if entry.Timestamp == 0 {
+        entry.Timestamp = time.Now().Unix()
+    }
+
+    if _, err := tx.Exec(`LOCK TABLE key_log IN EXCLUSIVE MODE`); err != nil {
+        return 0, err
+    }
+    var index int64
+    err := tx.QueryRow(`
+        INSERT INTO key_log (leaf_index, user_id, key_type, device_id, leaf_data)
+        SELECT COALESCE(MAX(leaf_index) + 1, 0), $1, $2, $3, $4 FROM key_log
+        RETURNING leaf_index`,
+        entry.UserID, entry.KeyType, nullString(entry.DeviceID), entry.Encode(),
+    ).Scan(&index)
+    return index, err
+}
+
+// GetKeyLogLeaves returns the leaf data of every entry from index on
+func (d *Database) GetKeyLogLeaves(from int64) ([][]byte, error) {
+    rows, err := d.db.Query(`
+        SELECT leaf_data FROM key_log WHERE leaf_index >= $1 ORDER BY leaf_index`, from)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var leaves [][]byte
+    for rows.Next() {
+        var data []byte
+        if err := rows.Scan(&data); err != nil {
+            return nil, err
+        }
+        leaves = append(leaves, data)
+    }
+    return leaves, rows.Err()
+}
+
+// GetKeyLogEntry returns nil if the log has no entry at index
+func (d *Database) GetKeyLogEntry(index int64) (*models.KeyLogEntry, error) {
+    entry := &models.KeyLogEntry{}
+    err := d.db.QueryRow(`
+        SELECT leaf_index, leaf_data, created_at FROM key_log WHERE leaf_index = $1`,
+        index,
+    ).Scan(&entry.Index, &entry.Data, &entry.CreatedAt)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    return entry, err
+}
+
+// GetUserKeyLog lists the log entries for a user's keys, oldest first
+func (d *Database) GetUserKeyLog(userID int64) ([]*models.KeyLogEntry, error) {
+    rows, err := d.db.Query(`
+        SELECT leaf_index, leaf_data, created_at FROM key_log
+        WHERE user_id = $1
+        ORDER BY leaf_index`,
+        userID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var entries []*models.KeyLogEntry
+    for rows.Next() {
+        entry := &models.KeyLogEntry{}
+        if err := rows.Scan(&entry.Index, &entry.Data, &entry.CreatedAt); err != nil {
+            return nil, err
+        }
+        entries = append(entries, entry)
+    }
+    return entries, rows.Err()
+}
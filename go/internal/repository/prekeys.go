@@ -0,0 +1,257 @@
+package repository
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"quantum-chat/internal/models"
+	"quantum-chat/internal/transparency"
+)
+
+var (
+    ErrNoDeviceKeys    = errors.New("device has no keys")
+    ErrPrekeyStockFull = errors.New("prekey stock is full")
+)
+
+// SaveDeviceKeys stores a device's identity key and signed prekey. A new
+// identity key is recorded in the key transparency log, and one-time
+// prekeys signed by a previous identity key are dropped.
+func (d *Database) SaveDeviceKeys(keys *models.DeviceKeys) error {
+    tx, err := d.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    var current []byte
+    err = tx.QueryRow(`
+        SELECT identity_key FROM device_keys
+        WHERE user_id = $1 AND device_id = $2
+        FOR UPDATE`,
+        keys.UserID, keys.DeviceID,
+    ).Scan(&current)
+    if err != nil && err != sql.ErrNoRows {
+        return err
+    }
+    if current != nil && !bytes.Equal(current, keys.IdentityKey) {
+        _, err = tx.Exec(`
+            DELETE FROM one_time_prekeys WHERE user_id = $1 AND device_id = $2`,
+            keys.UserID, keys.DeviceID)
+        if err != nil {
+            return err
+        }
+    }
+    if !bytes.Equal(current, keys.IdentityKey) {
+        _, err = appendKeyLog(tx, &transparency.Entry{
+            UserID:    keys.UserID,
+            KeyType:   transparency.KeyTypeIdentity,
+            DeviceID:  keys.DeviceID,
+            PublicKey: keys.IdentityKey,
+        })
+        if err != nil {
+            return err
+        }
+    }
+
+    err = tx.QueryRow(`
+        INSERT INTO device_keys (user_id, device_id, identity_key, signed_prekey_id, signed_prekey, signed_prekey_signature)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (user_id, device_id) DO UPDATE
+        SET identity_key = EXCLUDED.identity_key,
+            signed_prekey_id = EXCLUDED.signed_prekey_id,
+            signed_prekey = EXCLUDED.signed_prekey,
+            signed_prekey_signature = EXCLUDED.signed_prekey_signature,
+            updated_at = CURRENT_TIMESTAMP
+        RETURNING updated_at`,
+        keys.UserID, keys.DeviceID, keys.IdentityKey,
+        keys.SignedPrekey.KeyID, keys.SignedPrekey.PublicKey, keys.SignedPrekey.Signature,
+    ).Scan(&keys.UpdatedAt)
+    if err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+
+// GetDeviceKeys returns nil if the device never uploaded keys
+func (d *Database) GetDeviceKeys(userID int64, deviceID string) (*models.DeviceKeys, error) {
+    keys := &models.DeviceKeys{UserID: userID, DeviceID: deviceID}
+    err := d.db.QueryRow(`
+        SELECT identity_key, signed_prekey_id, signed_prekey, signed_prekey_signature, updated_at
+        FROM device_keys
+        WHERE user_id = $1 AND device_id = $2`,
+        userID, deviceID,
+    ).Scan(&keys.IdentityKey, &keys.SignedPrekey.KeyID, &keys.SignedPrekey.PublicKey,
+        &keys.SignedPrekey.Signature, &keys.UpdatedAt)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    return keys, err
+}
+
+// DeleteDeviceKeys removes a device's keys, one-time prekeys included, and
+// reports whether there were any
+func (d *Database) DeleteDeviceKeys(userID int64, deviceID string) (bool, error) {
+    result, err := d.db.Exec(`
+        DELETE FROM device_keys WHERE user_id = $1 AND device_id = $2`,
+        userID, deviceID)
+    if err != nil {
+        return false, err
+    }
+    n, err := result.RowsAffected()
+    return n > 0, err
+}
+
+// AddOneTimePrekeys stores a batch of one-time prekeys of both kinds in one
+// transaction. Key IDs the device already uploaded are skipped; it returns
+// how many were added. It returns ErrPrekeyStockFull if the device would
+// hold more than maxStock prekeys of either kind.
+func (d *Database) AddOneTimePrekeys(userID int64, deviceID string, pqPrekeys, classicalPrekeys []models.Prekey, maxStock int) (int, error) {
+    tx, err := d.db.Begin()
+    if err != nil {
+        return 0, err
+    }
+    defer tx.Rollback()
+
+    // Locking the device row makes concurrent uploads count in turn
+    var locked bool
+    err = tx.QueryRow(`
+        SELECT TRUE FROM device_keys WHERE user_id = $1 AND device_id = $2 FOR UPDATE`,
+        userID, deviceID,
+    ).Scan(&locked)
+    if err == sql.ErrNoRows {
+        return 0, ErrNoDeviceKeys
+    }
+    if err != nil {
+        return 0, err
+    }
+
+    var counts models.PrekeyCounts
+    err = tx.QueryRow(`
+        SELECT COUNT(*) FILTER (WHERE kind = $3), COUNT(*) FILTER (WHERE kind = $4)
+        FROM one_time_prekeys
+        WHERE user_id = $1 AND device_id = $2`,
+        userID, deviceID, models.PrekeyPQ, models.PrekeyClassical,
+    ).Scan(&counts.PQ, &counts.Classical)
+    if err != nil {
+        return 0, err
+    }
+    if counts.PQ+len(pqPrekeys) > maxStock || counts.Classical+len(classicalPrekeys) > maxStock {
+        return 0, ErrPrekeyStockFull
+    }
+
+    batches := []struct {
+        kind    string
+        prekeys []models.Prekey
+    }{
+        {models.PrekeyPQ, pqPrekeys},
+        {models.PrekeyClassical, classicalPrekeys},
+    }
+
+    added := 0
+    for _, batch := range batches {
+        for _, prekey := range batch.prekeys {
+            result, err := tx.Exec(`
+                INSERT INTO one_time_prekeys (user_id, device_id, kind, key_id, public_key, signature)
+                VALUES ($1, $2, $3, $4, $5, $6)
+                ON CONFLICT (user_id, device_id, kind, key_id) DO NOTHING`,
+                userID, deviceID, batch.kind, prekey.KeyID, prekey.PublicKey, nullBytes(prekey.Signature))
+            if err != nil {
+                return 0, err
+            }
+            n, err := result.RowsAffected()
+            if err != nil {
+                return 0, err
+            }
+            added += int(n)
+        }
+    }
+    return added, tx.Commit()
+}
+
+// CountOneTimePrekeys returns how many unused one-time prekeys a device has
+func (d *Database) CountOneTimePrekeys(userID int64, deviceID string) (*models.PrekeyCounts, error) {
+    counts := &models.PrekeyCounts{}
+    err := d.db.QueryRow(`
+        SELECT COUNT(*) FILTER (WHERE kind = $3), COUNT(*) FILTER (WHERE kind = $4)
+        FROM one_time_prekeys
+        WHERE user_id = $1 AND device_id = $2`,
+        userID, deviceID, models.PrekeyPQ, models.PrekeyClassical,
+    ).Scan(&counts.PQ, &counts.Classical)
+    return counts, err
+}
+
+// ClaimPrekeyBundles returns a bundle for each of the user's devices, or
+// only for deviceID if it is set. Every bundle takes one one-time prekey of
+// each kind, which is deleted in the same transaction so no two peers get
+// the same one.
+func (d *Database) ClaimPrekeyBundles(userID int64, deviceID string) ([]*models.PrekeyBundle, error) {
+    tx, err := d.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    rows, err := tx.Query(`
+        SELECT device_id, identity_key, signed_prekey_id, signed_prekey, signed_prekey_signature
+        FROM device_keys
+        WHERE user_id = $1 AND ($2 = '' OR device_id = $2)
+        ORDER BY device_id`,
+        userID, deviceID)
+    if err != nil {
+        return nil, err
+    }
+
+    var bundles []*models.PrekeyBundle
+    for rows.Next() {
+        bundle := &models.PrekeyBundle{}
+        if err := rows.Scan(&bundle.DeviceID, &bundle.IdentityKey, &bundle.SignedPrekey.KeyID,
+            &bundle.SignedPrekey.PublicKey, &bundle.SignedPrekey.Signature); err != nil {
+            rows.Close()
+            return nil, err
+        }
+        bundles = append(bundles, bundle)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    for _, bundle := range bundles {
+        if bundle.PQPrekey, err = claimOneTimePrekey(tx, userID, bundle.DeviceID, models.PrekeyPQ); err != nil {
+            return nil, err
+        }
+        if bundle.ClassicalPrekey, err = claimOneTimePrekey(tx, userID, bundle.DeviceID, models.PrekeyClassical); err != nil {
+            return nil, err
+        }
+    }
+    return bundles, tx.Commit()
+}
+
+// claimOneTimePrekey deletes and returns the oldest prekey of a kind, or nil
+// if none is left. SKIP LOCKED lets concurrent claims take different keys.
+func claimOneTimePrekey(tx *sql.Tx, userID int64, deviceID, kind string) (*models.Prekey, error) {
+    prekey := &models.Prekey{}
+    err := tx.QueryRow(`
+        DELETE FROM one_time_prekeys
+        WHERE (user_id, device_id, kind, key_id) = (
+            SELECT user_id, device_id, kind, key_id FROM one_time_prekeys
+            WHERE user_id = $1 AND device_id = $2 AND kind = $3
+            ORDER BY created_at, key_id
+            LIMIT 1
+            FOR UPDATE SKIP LOCKED)
+        RETURNING key_id, public_key, signature`,
+        userID, deviceID, kind,
+    ).Scan(&prekey.KeyID, &prekey.PublicKey, &prekey.Signature)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    return prekey, err
+}
+
+// nullBytes maps an empty slice to SQL NULL
+func nullBytes(b []byte) interface{} {
+    if len(b) == 0 {
+        return nil
+    }
+    return b
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"database/sql"
+	"quantum-chat/internal/models"
+	"time"
+)
+
+// UpdateLastSeen records when the user was last connected
+func (d *Database) UpdateLastSeen(userID int64, at time.Time) error {
+    _, err := d.db.Exec(`UPDATE users SET last_seen_at = $1 WHERE id = $2`, at, userID)
+    return err
+}
+
+// GetLastSeen returns nil if the user never disconnected
+func (d *Database) GetLastSeen(userID int64) (*time.Time, error) {
+    var lastSeen sql.NullTime
+    err := d.db.QueryRow(`SELECT last_seen_at FROM users WHERE id = $1`, userID).Scan(&lastSeen)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    if err != nil || !lastSeen.Valid {
+        return nil, err
+    }
+    return &lastSeen.Time, nil
+}
+
+// GetPrivacySettings returns nil if the user does not exist
+func (d *Database) GetPrivacySettings(userID int64) (*models.PrivacySettings, error) {
+    settings := &models.PrivacySettings{}
+    err := d.db.QueryRow(`
+        SELECT presence_visibility, message_requests
+        FROM users
+        WHERE id = $1`,
+        userID,
+    ).Scan(&settings.PresenceVisibility, &settings.MessageRequests)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    return settings, err
+}
+
+func (d *Database) UpdatePrivacySettings(userID int64, settings *models.PrivacySettings) error {
+    _, err := d.db.Exec(`
+        UPDATE users
+        SET presence_visibility = $1, message_requests = $2
+        WHERE id = $3`,
+        settings.PresenceVisibility, settings.MessageRequests, userID)
+    return err
+}
+
+// GetConversationPeerIDs returns every user who shares a conversation with userID
+func (d *Database) GetConversationPeerIDs(userID int64) ([]int64, error) {
+    rows, err := d.db.Query(`
+        SELECT DISTINCT other.user_id
+        FROM conversation_members mine
+        JOIN conversation_members other ON other.conversation_id = mine.conversation_id
+        WHERE mine.user_id = $1 AND other.user_id <> $1`,
+        userID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var ids []int64
+    for rows.Next() {
+        var id int64
+        if err := rows.Scan(&id); err != nil {
+            return nil, err
+        }
+        ids = append(ids, id)
+    }
+    return ids, rows.Err()
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"quantum-chat/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// SetReaction adds the user's reaction to a message, replacing an earlier one.
+// Encrypted reactions are stored as opaque blobs.
+func (d *Database) SetReaction(messageID, userID int64, reaction []byte, encrypted bool) error {
+    _, err := d.db.Exec(`
+        INSERT INTO reactions (message_id, user_id, reaction, encrypted)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (message_id, user_id)
+        DO UPDATE SET reaction = EXCLUDED.reaction, encrypted = EXCLUDED.encrypted, created_at = CURRENT_TIMESTAMP`,
+        messageID, userID, reaction, encrypted)
+    return err
+}
+
+// RemoveReaction reports whether the user had reacted to the message
+func (d *Database) RemoveReaction(messageID, userID int64) (bool, error) {
+    result, err := d.db.Exec(`DELETE FROM reactions WHERE message_id = $1 AND user_id = $2`, messageID, userID)
+    if err != nil {
+        return false, err
+    }
+    n, err := result.RowsAffected()
+    return n > 0, err
+}
+
+// GetReactionSummaries returns the grouped reactions of each given message
+func (d *Database) GetReactionSummaries(messageIDs []int64) (map[int64][]*models.ReactionSummary, error) {
+    rows, err := d.db.Query(`
+        SELECT message_id, user_id, reaction, encrypted
+        FROM reactions
+        WHERE message_id = ANY($1)
+        ORDER BY message_id, encrypted, reaction, user_id`,
+        pq.Array(messageIDs))
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    summaries := make(map[int64][]*models.ReactionSummary)
+    for rows.Next() {
+        var messageID, userID int64
+        var reaction []byte
+        var encrypted bool
+        if err := rows.Scan(&messageID, &userID, &reaction, &encrypted); err != nil {
+            return nil, err
+        }
+
+        list := summaries[messageID]
+        if !encrypted && len(list) > 0 {
+            last := list[len(list)-1]
+            if last.Ciphertext == nil && last.Emoji == string(reaction) {
+                last.Count++
+                last.UserIDs = append(last.UserIDs, userID)
+                continue
+            }
+        }
+
+        summary := &models.ReactionSummary{Count: 1, UserIDs: []int64{userID}}
+        if encrypted {
+            summary.Ciphertext = reaction
+        } else {
+            summary.Emoji = string(reaction)
+        }
+        summaries[messageID] = append(list, summary)
+    }
+    return summaries, rows.Err()
+}
@@ -4,9 +4,10 @@ import (
 	"database/sql"
 	"fmt"
 	"quantum-chat/internal/models"
+	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type Database struct {
@@ -47,23 +48,47 @@ func (d *Database) Ping() error {
 }
 
 // User methods
+
+// CreateUser stores a new user, starts their key history and records their
+// public key in the key transparency log
 func (d *Database) CreateUser(user *models.User) error {
+    tx, err := d.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
     query := `
-        INSERT INTO users (username, password, public_key)
-        VALUES ($1, $2, $3)
-        RETURNING id`
+        INSERT INTO users (username, password, public_key, role)
+        VALUES ($1, $2, $3, COALESCE($4, 'user'))
+        RETURNING id, role`
     
-    return d.db.QueryRow(query, 
+    err = tx.QueryRow(query, 
         user.Username, 
         user.Password, 
         user.PublicKey,
-    ).Scan(&user.ID)
+        nullString(user.Role),
+    ).Scan(&user.ID, &user.Role)
+    if err != nil {
+        return err
+    }
+
+    if _, err := addUserKey(tx, user.ID, user.PublicKey, time.Now()); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+
+// PromoteAdmins gives the admin role to the named users
+func (d *Database) PromoteAdmins(usernames []string) error {
+    _, err := d.db.Exec(`UPDATE users SET role = $1 WHERE username = ANY($2)`, models.UserRoleAdmin, pq.Array(usernames))
+    return err
 }
 
 func (d *Database) GetUser(username string) (*models.User, error) {
     user := &models.User{}
     query := `
-        SELECT id, username, password, public_key
+        SELECT id, username, password, public_key, role
         FROM users
         WHERE username = $1`
     
@@ -72,6 +97,7 @@ func (d *Database) GetUser(username string) (*models.User, error) {
         &user.Username,
         &user.Password,
         &user.PublicKey,
+        &user.Role,
     )
     if err == sql.ErrNoRows {
         return nil, nil
@@ -82,7 +108,7 @@ func (d *Database) GetUser(username string) (*models.User, error) {
 func (d *Database) GetUserByID(id int64) (*models.User, error) {
     user := &models.User{}
     query := `
-        SELECT id, username, password, public_key
+        SELECT id, username, password, public_key, role
         FROM users
         WHERE id = $1`
     
@@ -91,6 +117,7 @@ func (d *Database) GetUserByID(id int64) (*models.User, error) {
         &user.Username,
         &user.Password,
         &user.PublicKey,
+        &user.Role,
     )
     if err == sql.ErrNoRows {
         return nil, nil
@@ -99,30 +126,336 @@ func (d *Database) GetUserByID(id int64) (*models.User, error) {
 }
 
 // Message methods
-func (d *Database) SaveMessage(msg *models.Message) error {
+
+// messageColumns are the columns scanned by queryMessages
+const messageColumns = `m.id, COALESCE(m.conversation_id, 0), COALESCE(m.sender_id, 0), COALESCE(m.receiver_id, 0),
+               COALESCE(m.client_message_id, ''), COALESCE(m.seq, 0), m.type,
+               COALESCE(m.reply_to_message_id, 0), COALESCE(m.thread_root_id, 0), m.content, m.timestamp, m.read,
+               m.version, m.edited_at, m.deleted_at, m.expires_at,
+               ARRAY(SELECT a.attachment_id FROM message_attachments a
+                     WHERE a.message_id = m.id ORDER BY a.position)`
+
+// notExpired filters out messages m that are past their expiry at the time
+// in nowParam but were not reaped yet. The time comes from the caller so the
+// filter and the reaper agree on the clock.
+func notExpired(nowParam string) string {
+    return fmt.Sprintf(`(m.expires_at IS NULL OR m.expires_at > %s)`, nowParam)
+}
+
+// SaveMessage stores a message together with one delivery row per recipient
+// and assigns it the next sequence number of its conversation. A message
+// whose ClientMessageID the sender already used is not stored again: msg is
+// filled from the original and created is false.
+func (d *Database) SaveMessage(msg *models.Message, recipientIDs []int64) (created bool, err error) {
+    tx, err := d.db.Begin()
+    if err != nil {
+        return false, err
+    }
+    defer tx.Rollback()
+
+    // The row lock on the conversation serializes concurrent senders, so
+    // sequence numbers are strictly increasing and gap-free
+    if msg.ConversationID != 0 {
+        err := tx.QueryRow(`
+            UPDATE conversations SET last_seq = last_seq + 1
+            WHERE id = $1
+            RETURNING last_seq`,
+            msg.ConversationID,
+        ).Scan(&msg.Seq)
+        if err != nil {
+            return false, err
+        }
+    }
+
     query := `
-        INSERT INTO messages (sender_id, receiver_id, content, timestamp, read)
-        VALUES ($1, $2, $3, $4, $5)
-        RETURNING id`
-    
-    return d.db.QueryRow(query,
+        INSERT INTO messages (conversation_id, sender_id, receiver_id, client_message_id, seq,
+                              reply_to_message_id, thread_root_id, content, timestamp, read, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+        ON CONFLICT (sender_id, client_message_id) DO NOTHING
+        RETURNING id, version, type`
+
+    err = tx.QueryRow(query,
+        nullInt64(msg.ConversationID),
         msg.SenderID,
-        msg.ReceiverID,
+        nullInt64(msg.ReceiverID),
+        nullString(msg.ClientMessageID),
+        nullInt64(msg.Seq),
+        nullInt64(msg.ReplyToID),
+        nullInt64(msg.ThreadRootID),
         msg.Content,
         msg.Timestamp,
         msg.Read,
-    ).Scan(&msg.ID)
+        msg.ExpiresAt,
+    ).Scan(&msg.ID, &msg.Version, &msg.Type)
+    if err == sql.ErrNoRows {
+        original, err := scanMessage(tx.QueryRow(`
+            SELECT `+messageColumns+`
+            FROM messages m
+            WHERE m.sender_id = $1 AND m.client_message_id = $2`,
+            msg.SenderID, msg.ClientMessageID))
+        if err != nil {
+            return false, err
+        }
+        *msg = *original
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+
+    for i, attachmentID := range msg.AttachmentIDs {
+        _, err := tx.Exec(`
+            INSERT INTO message_attachments (message_id, attachment_id, position)
+            VALUES ($1, $2, $3)`,
+            msg.ID, attachmentID, i)
+        if err != nil {
+            return false, err
+        }
+    }
+
+    for _, recipientID := range recipientIDs {
+        _, err := tx.Exec(`
+            INSERT INTO message_recipients (message_id, user_id, status)
+            VALUES ($1, $2, $3)`,
+            msg.ID, recipientID, models.DeliveryStored)
+        if err != nil {
+            return false, err
+        }
+    }
+
+    return true, tx.Commit()
+}
+
+// MessageQuery selects one page of a user's message history. BeforeID and
+// AfterID are exclusive message ID cursors; IDs only grow, so pages stay
+// stable while new messages arrive. Messages the user deleted for themselves
+// are skipped; messages deleted for everyone come back as tombstones.
+type MessageQuery struct {
+    UserID         int64
+    PeerID         int64
+    ConversationID int64
+    ThreadRootID   int64
+    BeforeID       int64
+    AfterID        int64
+    Limit          int
+    Now            time.Time // Messages expired by then are left out
+}
+
+// GetMessages returns the page in ascending ID order. When only AfterID is
+// set the page starts right after it, otherwise it ends right before BeforeID
+// (or at the newest message).
+func (d *Database) GetMessages(q MessageQuery) ([]*models.Message, error) {
+    args := []interface{}{q.UserID}
+    where := []string{
+        `(m.sender_id = $1 OR EXISTS (
+            SELECT 1 FROM message_recipients r
+            WHERE r.message_id = m.id AND r.user_id = $1))`,
+        notHiddenFrom("$1"),
+    }
+    addArg := func(v interface{}) string {
+        args = append(args, v)
+        return fmt.Sprintf("$%d", len(args))
+    }
+
+    where = append(where, notExpired(addArg(q.Now)))
+    if q.ConversationID != 0 {
+        where = append(where, "m.conversation_id = "+addArg(q.ConversationID))
+    }
+    if q.ThreadRootID != 0 {
+        where = append(where, "m.thread_root_id = "+addArg(q.ThreadRootID))
+    }
+    if q.PeerID != 0 {
+        peer := addArg(q.PeerID)
+        where = append(where, fmt.Sprintf(
+            "((m.sender_id = $1 AND m.receiver_id = %s) OR (m.sender_id = %s AND m.receiver_id = $1))",
+            peer, peer))
+    }
+    if q.BeforeID != 0 {
+        where = append(where, "m.id < "+addArg(q.BeforeID))
+    }
+    if q.AfterID != 0 {
+        where = append(where, "m.id > "+addArg(q.AfterID))
+    }
+
+    ascending := q.AfterID != 0 && q.BeforeID == 0
+    order := "DESC"
+    if ascending {
+        order = "ASC"
+    }
+
+    query := fmt.Sprintf(`
+        SELECT `+messageColumns+`
+        FROM messages m
+        WHERE %s
+        ORDER BY m.id %s
+        LIMIT %s`,
+        strings.Join(where, " AND "), order, addArg(q.Limit))
+
+    messages, err := d.queryMessages(query, args...)
+    if err != nil {
+        return nil, err
+    }
+
+    if !ascending {
+        for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+            messages[i], messages[j] = messages[j], messages[i]
+        }
+    }
+    return messages, nil
+}
+
+// MarkMessagesRead marks the given messages, plus every message in convID up
+// to and including upToID, as read by userID. Only messages that were not
+// read before are returned.
+func (d *Database) MarkMessagesRead(userID int64, messageIDs []int64, convID, upToID int64) ([]*models.Receipt, error) {
+    tx, err := d.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    rows, err := tx.Query(`
+        UPDATE message_recipients r
+        SET status = $2,
+            delivered_at = COALESCE(r.delivered_at, CURRENT_TIMESTAMP),
+            read_at = CURRENT_TIMESTAMP
+        FROM messages m
+        WHERE r.message_id = m.id
+          AND r.user_id = $1
+          AND r.status <> $2
+          AND (m.id = ANY($3) OR (m.conversation_id = $4 AND m.id <= $5))
+        RETURNING m.id, COALESCE(m.conversation_id, 0), COALESCE(m.sender_id, 0)`,
+        userID, models.DeliveryRead, pq.Array(messageIDs), convID, upToID)
+    if err != nil {
+        return nil, err
+    }
+
+    var receipts []*models.Receipt
+    var ids []int64
+    for rows.Next() {
+        receipt := &models.Receipt{RecipientID: userID, Status: models.DeliveryRead}
+        if err := rows.Scan(&receipt.MessageID, &receipt.ConversationID, &receipt.SenderID); err != nil {
+            rows.Close()
+            return nil, err
+        }
+        receipts = append(receipts, receipt)
+        ids = append(ids, receipt.MessageID)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    // A message counts as read once every recipient has read it
+    _, err = tx.Exec(`
+        UPDATE messages
+        SET read = TRUE
+        WHERE id = ANY($1)
+          AND NOT EXISTS (
+            SELECT 1 FROM message_recipients
+            WHERE message_id = messages.id AND status <> $2)`,
+        pq.Array(ids), models.DeliveryRead)
+    if err != nil {
+        return nil, err
+    }
+
+    return receipts, tx.Commit()
 }
 
-func (d *Database) GetMessages(userID int64, limit int) ([]*models.Message, error) {
+// GetPendingMessages returns messages that still wait for delivery to userID,
+// oldest first, starting after the afterID cursor
+func (d *Database) GetPendingMessages(userID, afterID int64, limit int, now time.Time) ([]*models.Message, error) {
     query := `
-        SELECT id, sender_id, receiver_id, content, timestamp, read
-        FROM messages
-        WHERE sender_id = $1 OR receiver_id = $1
-        ORDER BY timestamp DESC
-        LIMIT $2`
-    
-    rows, err := d.db.Query(query, userID, limit)
+        SELECT `+messageColumns+`
+        FROM messages m
+        JOIN message_recipients r ON r.message_id = m.id
+        WHERE r.user_id = $1 AND r.status = $2 AND m.id > $3
+          AND m.deleted_at IS NULL
+          AND `+notExpired("$5")+`
+        ORDER BY m.id
+        LIMIT $4`
+
+    return d.queryMessages(query, userID, models.DeliveryStored, afterID, limit, now)
+}
+
+// MarkMessagesDelivered records that userID received the given messages. Only
+// messages that were still waiting for delivery are returned.
+func (d *Database) MarkMessagesDelivered(userID int64, messageIDs []int64) ([]*models.Receipt, error) {
+    rows, err := d.db.Query(`
+        UPDATE message_recipients r
+        SET status = $2, delivered_at = CURRENT_TIMESTAMP
+        FROM messages m
+        WHERE r.message_id = m.id
+          AND r.user_id = $1
+          AND r.status = $3
+          AND m.id = ANY($4)
+        RETURNING m.id, COALESCE(m.conversation_id, 0), COALESCE(m.sender_id, 0)`,
+        userID, models.DeliveryDelivered, models.DeliveryStored, pq.Array(messageIDs))
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var receipts []*models.Receipt
+    for rows.Next() {
+        receipt := &models.Receipt{RecipientID: userID, Status: models.DeliveryDelivered}
+        if err := rows.Scan(&receipt.MessageID, &receipt.ConversationID, &receipt.SenderID); err != nil {
+            return nil, err
+        }
+        receipts = append(receipts, receipt)
+    }
+    return receipts, rows.Err()
+}
+
+// GetMessagesAfterSeq returns the messages of a conversation visible to
+// userID with a sequence number above afterSeq, in sequence order. Tombstones
+// are included so clients can purge their copies.
+func (d *Database) GetMessagesAfterSeq(userID, convID, afterSeq int64, limit int, now time.Time) ([]*models.Message, error) {
+    query := `
+        SELECT `+messageColumns+`
+        FROM messages m
+        WHERE m.conversation_id = $2
+          AND m.seq > $3
+          AND (m.sender_id = $1 OR EXISTS (
+            SELECT 1 FROM message_recipients r
+            WHERE r.message_id = m.id AND r.user_id = $1))
+          AND `+notHiddenFrom("$1")+`
+          AND `+notExpired("$5")+`
+        ORDER BY m.seq
+        LIMIT $4`
+
+    return d.queryMessages(query, userID, convID, afterSeq, limit, now)
+}
+
+// GetConversationHeads returns the newest sequence number of every
+// conversation the user is a member of
+func (d *Database) GetConversationHeads(userID int64) ([]*models.ConversationHead, error) {
+    rows, err := d.db.Query(`
+        SELECT c.id, c.last_seq
+        FROM conversations c
+        JOIN conversation_members m ON m.conversation_id = c.id
+        WHERE m.user_id = $1
+        ORDER BY c.id`,
+        userID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var heads []*models.ConversationHead
+    for rows.Next() {
+        head := &models.ConversationHead{}
+        if err := rows.Scan(&head.ConversationID, &head.LastSeq); err != nil {
+            return nil, err
+        }
+        heads = append(heads, head)
+    }
+    return heads, rows.Err()
+}
+
+// queryMessages runs a query selecting the standard message columns
+func (d *Database) queryMessages(query string, args ...interface{}) ([]*models.Message, error) {
+    rows, err := d.db.Query(query, args...)
     if err != nil {
         return nil, err
     }
@@ -130,19 +463,101 @@ func (d *Database) GetMessages(userID int64, limit int) ([]*models.Message, erro
 
     var messages []*models.Message
     for rows.Next() {
-        msg := &models.Message{}
+        msg, err := scanMessage(rows)
+        if err != nil {
+            return nil, err
+        }
+        messages = append(messages, msg)
+    }
+    return messages, rows.Err()
+}
+
+// scanMessage scans one row selected with messageColumns
+func scanMessage(row interface{ Scan(...interface{}) error }) (*models.Message, error) {
+    msg := &models.Message{}
+    if err := row.Scan(messageFields(msg)...); err != nil {
+        return nil, err
+    }
+    return msg, nil
+}
+
+// messageFields returns the scan destinations for messageColumns, for
+// queries that select more columns after them
+func messageFields(msg *models.Message) []interface{} {
+    return []interface{}{
+        &msg.ID,
+        &msg.ConversationID,
+        &msg.SenderID,
+        &msg.ReceiverID,
+        &msg.ClientMessageID,
+        &msg.Seq,
+        &msg.Type,
+        &msg.ReplyToID,
+        &msg.ThreadRootID,
+        &msg.Content,
+        &msg.Timestamp,
+        &msg.Read,
+        &msg.Version,
+        &msg.EditedAt,
+        &msg.DeletedAt,
+        &msg.ExpiresAt,
+        pq.Array(&msg.AttachmentIDs),
+    }
+}
+
+// GetMessage returns nil if the message does not exist
+func (d *Database) GetMessage(id int64) (*models.Message, error) {
+    messages, err := d.queryMessages(`
+        SELECT `+messageColumns+`
+        FROM messages m
+        WHERE m.id = $1`, id)
+    if err != nil || len(messages) == 0 {
+        return nil, err
+    }
+    return messages[0], nil
+}
+
+// GetMessageReceipts returns the delivery state of a message for each recipient
+func (d *Database) GetMessageReceipts(messageID int64) ([]*models.Receipt, error) {
+    query := `
+        SELECT m.id, COALESCE(m.conversation_id, 0), COALESCE(m.sender_id, 0), r.user_id, r.status, r.delivered_at, r.read_at
+        FROM message_recipients r
+        JOIN messages m ON m.id = r.message_id
+        WHERE r.message_id = $1
+        ORDER BY r.user_id`
+
+    rows, err := d.db.Query(query, messageID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var receipts []*models.Receipt
+    for rows.Next() {
+        receipt := &models.Receipt{}
         err := rows.Scan(
-            &msg.ID,
-            &msg.SenderID,
-            &msg.ReceiverID,
-            &msg.Content,
-            &msg.Timestamp,
-            &msg.Read,
+            &receipt.MessageID,
+            &receipt.ConversationID,
+            &receipt.SenderID,
+            &receipt.RecipientID,
+            &receipt.Status,
+            &receipt.DeliveredAt,
+            &receipt.ReadAt,
         )
         if err != nil {
             return nil, err
         }
-        messages = append(messages, msg)
+        receipts = append(receipts, receipt)
     }
-    return messages, nil
+    return receipts, rows.Err()
+}
+
+// nullInt64 maps a zero ID to SQL NULL
+func nullInt64(v int64) sql.NullInt64 {
+    return sql.NullInt64{Int64: v, Valid: v != 0}
+}
+
+// nullString maps an empty string to SQL NULL
+func nullString(v string) sql.NullString {
+    return sql.NullString{String: v, Valid: v != ""}
 }
\ No newline at end of file
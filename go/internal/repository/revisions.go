@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"database/sql"
+	"quantum-chat/internal/models"
+)
+
+// EditMessage replaces the content of a message sent by senderID and keeps
+// the previous content as a revision. It returns nil if the sender has no
+// such message.
+func (d *Database) EditMessage(messageID, senderID int64, content []byte) (*models.Message, error) {
+    tx, err := d.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    // Lock the row so concurrent edits produce consecutive versions
+    current, err := scanMessage(tx.QueryRow(`
+        SELECT `+messageColumns+`
+        FROM messages m
+        WHERE m.id = $1 AND m.sender_id = $2 AND m.type <> $3 AND m.deleted_at IS NULL
+        FOR UPDATE`,
+        messageID, senderID, models.MessageTypeSystem))
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    _, err = tx.Exec(`
+        INSERT INTO message_revisions (message_id, version, content)
+        VALUES ($1, $2, $3)`,
+        messageID, current.Version, current.Content)
+    if err != nil {
+        return nil, err
+    }
+
+    err = tx.QueryRow(`
+        UPDATE messages
+        SET content = $1, version = version + 1, edited_at = CURRENT_TIMESTAMP
+        WHERE id = $2
+        RETURNING version, edited_at`,
+        content, messageID,
+    ).Scan(&current.Version, &current.EditedAt)
+    if err != nil {
+        return nil, err
+    }
+    current.Content = content
+
+    return current, tx.Commit()
+}
+
+// GetMessageRevisions returns the earlier versions of a message, oldest first
+func (d *Database) GetMessageRevisions(messageID int64) ([]*models.MessageRevision, error) {
+    rows, err := d.db.Query(`
+        SELECT message_id, version, content, created_at
+        FROM message_revisions
+        WHERE message_id = $1
+        ORDER BY version`,
+        messageID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var revisions []*models.MessageRevision
+    for rows.Next() {
+        revision := &models.MessageRevision{}
+        if err := rows.Scan(&revision.MessageID, &revision.Version, &revision.Content, &revision.CreatedAt); err != nil {
+            return nil, err
+        }
+        revisions = append(revisions, revision)
+    }
+    return revisions, rows.Err()
+}
+
+// GetMessageRecipientIDs returns the users a message was delivered to
+func (d *Database) GetMessageRecipientIDs(messageID int64) ([]int64, error) {
+    rows, err := d.db.Query(`SELECT user_id FROM message_recipients WHERE message_id = $1`, messageID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var ids []int64
+    for rows.Next() {
+        var id int64
+        if err := rows.Scan(&id); err != nil {
+            return nil, err
+        }
+        ids = append(ids, id)
+    }
+    return ids, rows.Err()
+}
+
+// IsMessageParticipant reports whether the user sent or received the message
+func (d *Database) IsMessageParticipant(messageID, userID int64) (bool, error) {
+    var ok bool
+    err := d.db.QueryRow(`
+        SELECT EXISTS (
+            SELECT 1 FROM messages WHERE id = $1 AND sender_id = $2
+            UNION ALL
+            SELECT 1 FROM message_recipients WHERE message_id = $1 AND user_id = $2)`,
+        messageID, userID,
+    ).Scan(&ok)
+    return ok, err
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"database/sql"
+	"quantum-chat/internal/models"
+	"time"
+)
+
+const scheduledColumns = `id, sender_id, conversation_id, COALESCE(client_message_id, ''), frame, send_at,
+               status, COALESCE(message_id, 0), COALESCE(error, ''), created_at`
+
+// CreateScheduledMessage stores a pending scheduled message. A message whose
+// ClientMessageID the sender already used is not stored again: sm is filled
+// from the original and created is false.
+func (d *Database) CreateScheduledMessage(sm *models.ScheduledMessage) (created bool, err error) {
+    err = d.db.QueryRow(`
+        INSERT INTO scheduled_messages (sender_id, conversation_id, client_message_id, frame, send_at)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (sender_id, client_message_id) DO NOTHING
+        RETURNING id, status, created_at`,
+        sm.SenderID, sm.ConversationID, nullString(sm.ClientMessageID), []byte(sm.Message), sm.SendAt,
+    ).Scan(&sm.ID, &sm.Status, &sm.CreatedAt)
+    if err == sql.ErrNoRows {
+        original, err := scanScheduledMessage(d.db.QueryRow(`
+            SELECT `+scheduledColumns+`
+            FROM scheduled_messages
+            WHERE sender_id = $1 AND client_message_id = $2`,
+            sm.SenderID, sm.ClientMessageID))
+        if err != nil {
+            return false, err
+        }
+        *sm = *original
+        return false, nil
+    }
+    return err == nil, err
+}
+
+// GetScheduledMessages lists the user's scheduled messages that were not
+// sent yet, the next one first
+func (d *Database) GetScheduledMessages(userID int64) ([]*models.ScheduledMessage, error) {
+    return d.queryScheduledMessages(`
+        SELECT `+scheduledColumns+`
+        FROM scheduled_messages
+        WHERE sender_id = $1 AND status IN ($2, $3)
+        ORDER BY send_at, id`,
+        userID, models.ScheduledPending, models.ScheduledSending)
+}
+
+// CancelScheduledMessage reports whether a pending message of the sender was
+// cancelled; messages already claimed for sending cannot be cancelled
+func (d *Database) CancelScheduledMessage(id, senderID int64) (bool, error) {
+    result, err := d.db.Exec(`
+        UPDATE scheduled_messages
+        SET status = $3
+        WHERE id = $1 AND sender_id = $2 AND status = $4`,
+        id, senderID, models.ScheduledCancelled, models.ScheduledPending)
+    if err != nil {
+        return false, err
+    }
+    n, err := result.RowsAffected()
+    return n > 0, err
+}
+
+// ClaimScheduledMessages moves up to limit messages due at now to sending
+// and returns them. Rows locked by another instance are skipped, so each
+// message is claimed once. Claims older than staleBefore are taken over, as
+// their instance is assumed to have died while sending.
+func (d *Database) ClaimScheduledMessages(now, staleBefore time.Time, limit int) ([]*models.ScheduledMessage, error) {
+    return d.queryScheduledMessages(`
+        UPDATE scheduled_messages
+        SET status = $1, claimed_at = $2
+        WHERE id IN (
+            SELECT id FROM scheduled_messages
+            WHERE (status = $3 AND send_at <= $2)
+               OR (status = $1 AND claimed_at < $4)
+            ORDER BY send_at
+            LIMIT $5
+            FOR UPDATE SKIP LOCKED)
+        RETURNING `+scheduledColumns,
+        models.ScheduledSending, now, models.ScheduledPending, staleBefore, limit)
+}
+
+// FinishScheduledMessage records the outcome of sending a claimed message
+func (d *Database) FinishScheduledMessage(id int64, status string, messageID int64, errText string) error {
+    _, err := d.db.Exec(`
+        UPDATE scheduled_messages
+        SET status = $2, message_id = $3, error = $4
+        WHERE id = $1`,
+        id, status, nullInt64(messageID), nullString(errText))
+    return err
+}
+
+func (d *Database) queryScheduledMessages(query string, args ...interface{}) ([]*models.ScheduledMessage, error) {
+    rows, err := d.db.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var messages []*models.ScheduledMessage
+    for rows.Next() {
+        sm, err := scanScheduledMessage(rows)
+        if err != nil {
+            return nil, err
+        }
+        messages = append(messages, sm)
+    }
+    return messages, rows.Err()
+}
+
+func scanScheduledMessage(row interface{ Scan(...interface{}) error }) (*models.ScheduledMessage, error) {
+    sm := &models.ScheduledMessage{}
+    var frame []byte
+    err := row.Scan(
+        &sm.ID,
+        &sm.SenderID,
+        &sm.ConversationID,
+        &sm.ClientMessageID,
+        &frame,
+        &sm.SendAt,
+        &sm.Status,
+        &sm.MessageID,
+        &sm.Error,
+        &sm.CreatedAt,
+    )
+    if err != nil {
+        return nil, err
+    }
+    sm.Message = frame
+    return sm, nil
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"database/sql"
+	"quantum-chat/internal/models"
+)
+
+// SetDeliveryTokenHash stores the hash of the user's sealed sender delivery
+// token; nil turns sealed sender off
+func (d *Database) SetDeliveryTokenHash(userID int64, hash []byte) error {
+    _, err := d.db.Exec(`UPDATE users SET delivery_token_hash = $2 WHERE id = $1`, userID, nullBytes(hash))
+    return err
+}
+
+// GetDeliveryTokenHash returns nil if the user does not accept sealed sender
+// messages or does not exist
+func (d *Database) GetDeliveryTokenHash(userID int64) ([]byte, error) {
+    var hash []byte
+    err := d.db.QueryRow(`SELECT delivery_token_hash FROM users WHERE id = $1`, userID).Scan(&hash)
+    if err != nil && err != sql.ErrNoRows {
+        return nil, err
+    }
+    return hash, nil
+}
+
+// SaveSealedMessage stores a sealed sender message for its receiver. It has
+// no sender and no conversation, since either would tell who wrote it.
+func (d *Database) SaveSealedMessage(msg *models.Message) error {
+    tx, err := d.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    err = tx.QueryRow(`
+        INSERT INTO messages (receiver_id, type, content, timestamp)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, version`,
+        msg.ReceiverID, models.MessageTypeSealed, msg.Content, msg.Timestamp,
+    ).Scan(&msg.ID, &msg.Version)
+    if err != nil {
+        return err
+    }
+    msg.Type = models.MessageTypeSealed
+
+    _, err = tx.Exec(`
+        INSERT INTO message_recipients (message_id, user_id, status)
+        VALUES ($1, $2, $3)`,
+        msg.ID, msg.ReceiverID, models.DeliveryStored)
+    if err != nil {
+        return err
+    }
+    return tx.Commit()
+}
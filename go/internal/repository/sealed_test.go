@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"database/sql"
+	"quantum-chat/internal/models"
+	"testing"
+	"time"
+)
+
+func TestSealedMessageHasNoSender(t *testing.T) {
+    d := testDatabase(t)
+    receiverID := createTestUser(t, d, "sealed-receiver")
+
+    msg := &models.Message{
+        ReceiverID: receiverID,
+        Content:    []byte(`"sealed"`),
+        Timestamp:  time.Now().Unix(),
+    }
+    if err := d.SaveSealedMessage(msg); err != nil {
+        t.Fatalf("save sealed message: %v", err)
+    }
+
+    var senderID, conversationID sql.NullInt64
+    var messageType string
+    err := d.db.QueryRow(`SELECT sender_id, conversation_id, type FROM messages WHERE id = $1`, msg.ID).
+        Scan(&senderID, &conversationID, &messageType)
+    if err != nil {
+        t.Fatalf("load message: %v", err)
+    }
+    if senderID.Valid || conversationID.Valid || messageType != models.MessageTypeSealed {
+        t.Fatalf("stored sender %v, conversation %v, type %q; want NULL, NULL, sealed", senderID, conversationID, messageType)
+    }
+
+    pending, err := d.GetPendingMessages(receiverID, 0, 10, time.Now())
+    if err != nil {
+        t.Fatalf("get pending messages: %v", err)
+    }
+    if !containsMessage(pending, msg.ID) {
+        t.Fatal("sealed message not pending for its receiver")
+    }
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"quantum-chat/internal/models"
+	"time"
+)
+
+// GetThreads lists the threads of a conversation visible to userID, most
+// recently active first. beforeReplyID is an exclusive cursor on the
+// threads' LastReplyID. Unread counts only cover replies addressed to the
+// user that they have not read yet, and threads whose root was never
+// addressed to the user are left out like their replies would be.
+func (d *Database) GetThreads(userID, convID, beforeReplyID int64, limit int, now time.Time) ([]*models.Thread, error) {
+    query := `
+        SELECT ` + messageColumns + `,
+               t.reply_count, t.unread_count, t.last_reply_id, t.last_reply_at
+        FROM (
+            SELECT m.thread_root_id AS root_id,
+                   COUNT(*) AS reply_count,
+                   COUNT(*) FILTER (WHERE r.status IS NOT NULL AND r.status <> $3) AS unread_count,
+                   MAX(m.id) AS last_reply_id,
+                   MAX(m.timestamp) AS last_reply_at
+            FROM messages m
+            LEFT JOIN message_recipients r ON r.message_id = m.id AND r.user_id = $1
+            WHERE m.conversation_id = $2
+              AND m.thread_root_id IS NOT NULL
+              AND m.deleted_at IS NULL
+              AND ` + notExpired("$6") + `
+              AND (m.sender_id = $1 OR r.user_id IS NOT NULL)
+              AND ` + notHiddenFrom("$1") + `
+            GROUP BY m.thread_root_id
+        ) t
+        JOIN messages m ON m.id = t.root_id
+        WHERE ($4 = 0 OR t.last_reply_id < $4)
+          AND (m.sender_id = $1 OR EXISTS (
+              SELECT 1 FROM message_recipients rr
+              WHERE rr.message_id = m.id AND rr.user_id = $1))
+          AND ` + notHiddenFrom("$1") + `
+          AND ` + notExpired("$6") + `
+        ORDER BY t.last_reply_id DESC
+        LIMIT $5`
+
+    rows, err := d.db.Query(query, userID, convID, models.DeliveryRead, beforeReplyID, limit, now)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var threads []*models.Thread
+    for rows.Next() {
+        root := &models.Message{}
+        thread := &models.Thread{Root: root}
+        fields := append(messageFields(root),
+            &thread.ReplyCount,
+            &thread.UnreadCount,
+            &thread.LastReplyID,
+            &thread.LastReplyAt,
+        )
+        if err := rows.Scan(fields...); err != nil {
+            return nil, err
+        }
+        threads = append(threads, thread)
+    }
+    return threads, rows.Err()
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"database/sql"
+	"quantum-chat/internal/models"
+	"quantum-chat/internal/transparency"
+	"time"
+)
+
+const userKeyColumns = `id, user_id, public_key, log_index, valid_from, valid_until`
+
+// addUserKey logs a new account key and opens its validity interval
+func addUserKey(tx *sql.Tx, userID int64, publicKey []byte, from time.Time) (*models.UserKey, error) {
+    index, err := appendKeyLog(tx, &transparency.Entry{
+        UserID:    userID,
+        KeyType:   transparency.KeyTypeAccount,
+        PublicKey: publicKey,
+        Timestamp: from.Unix(),
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    return scanUserKey(tx.QueryRow(`
+        INSERT INTO user_keys (user_id, public_key, log_index, valid_from)
+        VALUES ($1, $2, $3, $4)
+        RETURNING `+userKeyColumns,
+        userID, publicKey, index, from))
+}
+
+// RotateUserKey makes publicKey the user's current key. The previous key's
+// interval ends where the new one starts, so every instant maps to exactly
+// one key.
+func (d *Database) RotateUserKey(userID int64, publicKey []byte) (*models.UserKey, error) {
+    tx, err := d.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    // Locking the user row makes concurrent rotations take turns
+    var previous []byte
+    var createdAt time.Time
+    err = tx.QueryRow(`
+        SELECT public_key, created_at FROM users WHERE id = $1 FOR UPDATE`,
+        userID,
+    ).Scan(&previous, &createdAt)
+    if err != nil {
+        return nil, err
+    }
+
+    now := time.Now()
+    result, err := tx.Exec(`
+        UPDATE user_keys SET valid_until = $2
+        WHERE user_id = $1 AND valid_until IS NULL`,
+        userID, now)
+    if err != nil {
+        return nil, err
+    }
+    if n, err := result.RowsAffected(); err != nil {
+        return nil, err
+    } else if n == 0 {
+        // Users created before key history have no row for their first key
+        _, err = tx.Exec(`
+            INSERT INTO user_keys (user_id, public_key, valid_from, valid_until)
+            VALUES ($1, $2, $3, $4)`,
+            userID, previous, createdAt, now)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    key, err := addUserKey(tx, userID, publicKey, now)
+    if err != nil {
+        return nil, err
+    }
+    if _, err := tx.Exec(`UPDATE users SET public_key = $2 WHERE id = $1`, userID, publicKey); err != nil {
+        return nil, err
+    }
+    return key, tx.Commit()
+}
+
+// GetUserKeys lists a user's account keys, newest first
+func (d *Database) GetUserKeys(userID int64) ([]*models.UserKey, error) {
+    rows, err := d.db.Query(`
+        SELECT `+userKeyColumns+`
+        FROM user_keys
+        WHERE user_id = $1
+        ORDER BY valid_from DESC, id DESC`,
+        userID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var keys []*models.UserKey
+    for rows.Next() {
+        key, err := scanUserKey(rows)
+        if err != nil {
+            return nil, err
+        }
+        keys = append(keys, key)
+    }
+    return keys, rows.Err()
+}
+
+// GetUserKeyAt returns the key that was current at t, or nil
+func (d *Database) GetUserKeyAt(userID int64, t time.Time) (*models.UserKey, error) {
+    key, err := scanUserKey(d.db.QueryRow(`
+        SELECT `+userKeyColumns+`
+        FROM user_keys
+        WHERE user_id = $1 AND valid_from <= $2 AND (valid_until IS NULL OR valid_until > $2)
+        ORDER BY valid_from DESC
+        LIMIT 1`,
+        userID, t))
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    return key, err
+}
+
+// scanUserKey scans one row selected with userKeyColumns
+func scanUserKey(row interface{ Scan(...interface{}) error }) (*models.UserKey, error) {
+    key := &models.UserKey{}
+    var logIndex sql.NullInt64
+    var validUntil sql.NullTime
+    err := row.Scan(&key.ID, &key.UserID, &key.PublicKey, &logIndex, &key.ValidFrom, &validUntil)
+    if err != nil {
+        return nil, err
+    }
+    if logIndex.Valid {
+        key.LogIndex = &logIndex.Int64
+    }
+    if validUntil.Valid {
+        key.ValidUntil = &validUntil.Time
+    }
+    return key, nil
+}
@@ -0,0 +1,84 @@
+package transparency
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+)
+
+// Kinds of keys recorded in the log
+const (
+    KeyTypeAccount  = "account"  // The user's registration public key
+    KeyTypeIdentity = "identity" // A device identity key
+)
+
+// treeHeadContext separates tree head signatures from anything else the
+// key might sign
+const treeHeadContext = "quantum-chat tree head v1\x00"
+
+var ErrInvalidSignature = errors.New("tree head signature does not verify")
+
+// Entry is one key publication. Its JSON encoding is the leaf data clients
+// hash, so fields are only ever added at the end.
+type Entry struct {
+    UserID    int64  `json:"user_id"`
+    KeyType   string `json:"key_type"`
+    DeviceID  string `json:"device_id,omitempty"`
+    PublicKey []byte `json:"public_key"`
+    Timestamp int64  `json:"timestamp"`
+}
+
+// Encode returns the leaf data for the entry
+func (e *Entry) Encode() []byte {
+    data, _ := json.Marshal(e)
+    return data
+}
+
+// TreeHead is a signed commitment to the log at some size
+type TreeHead struct {
+    TreeSize  uint64 `json:"tree_size"`
+    RootHash  []byte `json:"root_hash"`
+    Timestamp int64  `json:"timestamp"` // Unix milliseconds
+    Signature []byte `json:"signature"`
+}
+
+// signedData is the context string, the size, the timestamp and the root
+func (th *TreeHead) signedData() []byte {
+    b := make([]byte, 0, len(treeHeadContext)+16+len(th.RootHash))
+    b = append(b, treeHeadContext...)
+    b = binary.BigEndian.AppendUint64(b, th.TreeSize)
+    b = binary.BigEndian.AppendUint64(b, uint64(th.Timestamp))
+    return append(b, th.RootHash...)
+}
+
+// Signer signs tree heads with the log's Ed25519 key
+type Signer struct {
+    key ed25519.PrivateKey
+}
+
+// NewSigner creates a signer from a 32-byte Ed25519 seed
+func NewSigner(seed []byte) (*Signer, error) {
+    if len(seed) != ed25519.SeedSize {
+        return nil, errors.New("signing key seed must be 32 bytes")
+    }
+    return &Signer{key: ed25519.NewKeyFromSeed(seed)}, nil
+}
+
+// PublicKey returns the key clients verify tree heads with
+func (s *Signer) PublicKey() ed25519.PublicKey {
+    return s.key.Public().(ed25519.PublicKey)
+}
+
+// Sign fills in the tree head's signature
+func (s *Signer) Sign(th *TreeHead) {
+    th.Signature = ed25519.Sign(s.key, th.signedData())
+}
+
+// VerifyTreeHead checks a tree head signature
+func VerifyTreeHead(publicKey ed25519.PublicKey, th *TreeHead) error {
+    if !ed25519.Verify(publicKey, th.signedData(), th.Signature) {
+        return ErrInvalidSignature
+    }
+    return nil
+}
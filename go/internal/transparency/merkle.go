@@ -0,0 +1,239 @@
+// Package transparency implements the key transparency log: an append-only
+// Merkle tree, hashed as in RFC 6962, over every public key the server
+// publishes. Clients keep the signed tree heads they see and ask for
+// consistency proofs between them, so a server that shows different keys to
+// different people has to fork the log, which the clients can detect.
+package transparency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"math/bits"
+)
+
+var (
+    ErrInvalidSize  = errors.New("tree size out of range")
+    ErrInvalidIndex = errors.New("leaf index out of range")
+    ErrInvalidProof = errors.New("proof does not verify")
+)
+
+// LeafHash hashes a log entry: SHA-256(0x00 || data)
+func LeafHash(data []byte) []byte {
+    h := sha256.New()
+    h.Write([]byte{0})
+    h.Write(data)
+    return h.Sum(nil)
+}
+
+// nodeHash hashes two children: SHA-256(0x01 || left || right)
+func nodeHash(left, right []byte) []byte {
+    h := sha256.New()
+    h.Write([]byte{1})
+    h.Write(left)
+    h.Write(right)
+    return h.Sum(nil)
+}
+
+// emptyRoot is the root of the empty tree
+func emptyRoot() []byte {
+    sum := sha256.Sum256(nil)
+    return sum[:]
+}
+
+// Tree keeps the hash of every complete subtree, so roots and proofs for
+// any earlier size only hash along the right edge
+type Tree struct {
+    // levels[l][i] is the root of leaves [i<<l, (i+1)<<l)
+    levels [][][]byte
+}
+
+// NewTree returns an empty tree
+func NewTree() *Tree {
+    return &Tree{levels: [][][]byte{nil}}
+}
+
+// Size returns the number of leaves
+func (t *Tree) Size() uint64 {
+    return uint64(len(t.levels[0]))
+}
+
+// Append adds a leaf hash and every subtree it completes
+func (t *Tree) Append(leafHash []byte) {
+    t.levels[0] = append(t.levels[0], leafHash)
+    index := len(t.levels[0]) - 1
+    for level := 0; index%2 == 1; level++ {
+        if level+1 == len(t.levels) {
+            t.levels = append(t.levels, nil)
+        }
+        parent := nodeHash(t.levels[level][index-1], t.levels[level][index])
+        t.levels[level+1] = append(t.levels[level+1], parent)
+        index /= 2
+    }
+}
+
+// Root returns the root hash of the first size leaves
+func (t *Tree) Root(size uint64) ([]byte, error) {
+    if size > t.Size() {
+        return nil, ErrInvalidSize
+    }
+    if size == 0 {
+        return emptyRoot(), nil
+    }
+    return t.subtree(0, size), nil
+}
+
+// InclusionProof returns the audit path of leaf index in the tree of the
+// first size leaves (RFC 6962 section 2.1.1)
+func (t *Tree) InclusionProof(index, size uint64) ([][]byte, error) {
+    if size > t.Size() {
+        return nil, ErrInvalidSize
+    }
+    if index >= size {
+        return nil, ErrInvalidIndex
+    }
+    return t.path(index, 0, size), nil
+}
+
+// ConsistencyProof proves that the tree of the first first leaves is a
+// prefix of the tree of the first second leaves (RFC 6962 section 2.1.2)
+func (t *Tree) ConsistencyProof(first, second uint64) ([][]byte, error) {
+    if second > t.Size() || first > second {
+        return nil, ErrInvalidSize
+    }
+    if first == 0 || first == second {
+        return [][]byte{}, nil
+    }
+    return t.subproof(first, 0, second, true), nil
+}
+
+func (t *Tree) path(index, lo, hi uint64) [][]byte {
+    n := hi - lo
+    if n == 1 {
+        return [][]byte{}
+    }
+    k := split(n)
+    if index < k {
+        return append(t.path(index, lo, lo+k), t.subtree(lo+k, hi))
+    }
+    return append(t.path(index-k, lo+k, hi), t.subtree(lo, lo+k))
+}
+
+func (t *Tree) subproof(m, lo, hi uint64, complete bool) [][]byte {
+    n := hi - lo
+    if m == n {
+        if complete {
+            return [][]byte{}
+        }
+        return [][]byte{t.subtree(lo, hi)}
+    }
+    k := split(n)
+    if m <= k {
+        return append(t.subproof(m, lo, lo+k, complete), t.subtree(lo+k, hi))
+    }
+    return append(t.subproof(m-k, lo+k, hi, false), t.subtree(lo, lo+k))
+}
+
+// subtree returns the root of leaves [lo, hi). Aligned power-of-two ranges
+// are stored; anything else is split like the tree itself.
+func (t *Tree) subtree(lo, hi uint64) []byte {
+    n := hi - lo
+    if n&(n-1) == 0 && lo%n == 0 {
+        level := bits.TrailingZeros64(n)
+        return t.levels[level][lo>>level]
+    }
+    k := split(n)
+    return nodeHash(t.subtree(lo, lo+k), t.subtree(lo+k, hi))
+}
+
+// split returns the largest power of two smaller than n, for n > 1
+func split(n uint64) uint64 {
+    return 1 << (bits.Len64(n-1) - 1)
+}
+
+// VerifyInclusion checks an audit path for the leaf at index in a tree of
+// size leaves with the given root (RFC 9162 section 2.1.3.2)
+func VerifyInclusion(leafHash []byte, index, size uint64, proof [][]byte, root []byte) error {
+    if index >= size {
+        return ErrInvalidIndex
+    }
+
+    fn, sn := index, size-1
+    r := leafHash
+    for _, p := range proof {
+        if sn == 0 {
+            return ErrInvalidProof
+        }
+        if fn&1 == 1 || fn == sn {
+            r = nodeHash(p, r)
+            for fn&1 == 0 && fn != 0 {
+                fn >>= 1
+                sn >>= 1
+            }
+        } else {
+            r = nodeHash(r, p)
+        }
+        fn >>= 1
+        sn >>= 1
+    }
+    if sn != 0 || !bytes.Equal(r, root) {
+        return ErrInvalidProof
+    }
+    return nil
+}
+
+// VerifyConsistency checks that the tree of size first with firstRoot is a
+// prefix of the tree of size second with secondRoot (RFC 9162 section
+// 2.1.4.2)
+func VerifyConsistency(first, second uint64, firstRoot, secondRoot []byte, proof [][]byte) error {
+    if first > second {
+        return ErrInvalidSize
+    }
+    if first == second {
+        if len(proof) != 0 || !bytes.Equal(firstRoot, secondRoot) {
+            return ErrInvalidProof
+        }
+        return nil
+    }
+    if first == 0 {
+        if len(proof) != 0 {
+            return ErrInvalidProof
+        }
+        return nil
+    }
+    if len(proof) == 0 {
+        return ErrInvalidProof
+    }
+
+    if first&(first-1) == 0 {
+        proof = append([][]byte{firstRoot}, proof...)
+    }
+    fn, sn := first-1, second-1
+    for fn&1 == 1 {
+        fn >>= 1
+        sn >>= 1
+    }
+
+    fr, sr := proof[0], proof[0]
+    for _, c := range proof[1:] {
+        if sn == 0 {
+            return ErrInvalidProof
+        }
+        if fn&1 == 1 || fn == sn {
+            fr = nodeHash(c, fr)
+            sr = nodeHash(c, sr)
+            for fn&1 == 0 && fn != 0 {
+                fn >>= 1
+                sn >>= 1
+            }
+        } else {
+            sr = nodeHash(sr, c)
+        }
+        fn >>= 1
+        sn >>= 1
+    }
+    if sn != 0 || !bytes.Equal(fr, firstRoot) || !bytes.Equal(sr, secondRoot) {
+        return ErrInvalidProof
+    }
+    return nil
+}
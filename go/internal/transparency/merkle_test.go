@@ -0,0 +1,301 @@
+package transparency
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+	"testing"
+)
+
+// maxTestSize covers several complete and incomplete levels of the tree
+const maxTestSize = 70
+
+// refRoot is MTH from RFC 6962 section 2.1, computed directly on the leaves
+func refRoot(leaves [][]byte) []byte {
+    n := uint64(len(leaves))
+    switch n {
+    case 0:
+        return emptyRoot()
+    case 1:
+        return leaves[0]
+    }
+    k := split(n)
+    return nodeHash(refRoot(leaves[:k]), refRoot(leaves[k:]))
+}
+
+// refPath is PATH from RFC 6962 section 2.1.1
+func refPath(index uint64, leaves [][]byte) [][]byte {
+    n := uint64(len(leaves))
+    if n <= 1 {
+        return [][]byte{}
+    }
+    k := split(n)
+    if index < k {
+        return append(refPath(index, leaves[:k]), refRoot(leaves[k:]))
+    }
+    return append(refPath(index-k, leaves[k:]), refRoot(leaves[:k]))
+}
+
+// refSubproof is SUBPROOF from RFC 6962 section 2.1.2
+func refSubproof(m uint64, leaves [][]byte, complete bool) [][]byte {
+    n := uint64(len(leaves))
+    if m == n {
+        if complete {
+            return [][]byte{}
+        }
+        return [][]byte{refRoot(leaves)}
+    }
+    k := split(n)
+    if m <= k {
+        return append(refSubproof(m, leaves[:k], complete), refRoot(leaves[k:]))
+    }
+    return append(refSubproof(m-k, leaves[k:], false), refRoot(leaves[:k]))
+}
+
+func testLeaves(n int) [][]byte {
+    leaves := make([][]byte, n)
+    for i := range leaves {
+        leaves[i] = LeafHash([]byte(fmt.Sprintf("leaf %d", i)))
+    }
+    return leaves
+}
+
+func testTree(leaves [][]byte) *Tree {
+    tree := NewTree()
+    for _, leaf := range leaves {
+        tree.Append(leaf)
+    }
+    return tree
+}
+
+func equalProofs(a, b [][]byte) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for i := range a {
+        if !bytes.Equal(a[i], b[i]) {
+            return false
+        }
+    }
+    return true
+}
+
+// flipped returns a copy of b with its first bit inverted
+func flipped(b []byte) []byte {
+    c := bytes.Clone(b)
+    c[0] ^= 1
+    return c
+}
+
+// tamperedProofs returns every proof that differs from proof in one element,
+// plus the proof with an element dropped and one added
+func tamperedProofs(proof [][]byte) [][][]byte {
+    var tampered [][][]byte
+    for i := range proof {
+        p := append([][]byte{}, proof...)
+        p[i] = flipped(p[i])
+        tampered = append(tampered, p)
+    }
+    if len(proof) > 0 {
+        tampered = append(tampered, proof[:len(proof)-1])
+    }
+    return append(tampered, append(append([][]byte{}, proof...), LeafHash(nil)))
+}
+
+func TestLeafAndNodeHashes(t *testing.T) {
+    // Leaves and nodes are domain separated, so a node can never pass as a leaf
+    left, right := LeafHash([]byte("a")), LeafHash([]byte("b"))
+    if bytes.Equal(LeafHash(append(bytes.Clone(left), right...)), nodeHash(left, right)) {
+        t.Fatal("leaf hash equals node hash of the same bytes")
+    }
+    if got := fmt.Sprintf("%x", emptyRoot()); got != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+        t.Fatalf("empty root = %s", got)
+    }
+}
+
+func TestRoot(t *testing.T) {
+    leaves := testLeaves(maxTestSize)
+    tree := NewTree()
+    for n := 0; n <= maxTestSize; n++ {
+        if got := tree.Size(); got != uint64(n) {
+            t.Fatalf("size = %d, want %d", got, n)
+        }
+        // Every earlier root stays available as the tree grows
+        for size := 0; size <= n; size++ {
+            root, err := tree.Root(uint64(size))
+            if err != nil {
+                t.Fatalf("root(%d) at size %d: %v", size, n, err)
+            }
+            if want := refRoot(leaves[:size]); !bytes.Equal(root, want) {
+                t.Fatalf("root(%d) at size %d = %x, want %x", size, n, root, want)
+            }
+        }
+        if _, err := tree.Root(uint64(n + 1)); err != ErrInvalidSize {
+            t.Fatalf("root(%d) at size %d: error = %v, want %v", n+1, n, err, ErrInvalidSize)
+        }
+        if n < maxTestSize {
+            tree.Append(leaves[n])
+        }
+    }
+}
+
+func TestInclusionProofs(t *testing.T) {
+    leaves := testLeaves(maxTestSize)
+    tree := testTree(leaves)
+
+    for size := uint64(1); size <= maxTestSize; size++ {
+        root := refRoot(leaves[:size])
+        for index := uint64(0); index < size; index++ {
+            proof, err := tree.InclusionProof(index, size)
+            if err != nil {
+                t.Fatalf("proof(%d, %d): %v", index, size, err)
+            }
+            if want := refPath(index, leaves[:size]); !equalProofs(proof, want) {
+                t.Fatalf("proof(%d, %d) differs from the reference", index, size)
+            }
+            if err := VerifyInclusion(leaves[index], index, size, proof, root); err != nil {
+                t.Fatalf("verify(%d, %d): %v", index, size, err)
+            }
+
+            if VerifyInclusion(leaves[index], index, size, proof, flipped(root)) == nil {
+                t.Fatalf("verify(%d, %d) accepted a tampered root", index, size)
+            }
+            if VerifyInclusion(flipped(leaves[index]), index, size, proof, root) == nil {
+                t.Fatalf("verify(%d, %d) accepted a tampered leaf", index, size)
+            }
+            for _, p := range tamperedProofs(proof) {
+                if VerifyInclusion(leaves[index], index, size, p, root) == nil {
+                    t.Fatalf("verify(%d, %d) accepted a tampered proof", index, size)
+                }
+            }
+            // The size is bound through the root, so a proof for one size
+            // must not verify against the tree at another
+            if size < maxTestSize && VerifyInclusion(leaves[index], index, size+1, proof, refRoot(leaves[:size+1])) == nil {
+                t.Fatalf("verify(%d, %d) accepted size %d", index, size, size+1)
+            }
+            if size > index+1 && VerifyInclusion(leaves[index], index, size-1, proof, refRoot(leaves[:size-1])) == nil {
+                t.Fatalf("verify(%d, %d) accepted size %d", index, size, size-1)
+            }
+            if index+1 < size && VerifyInclusion(leaves[index], index+1, size, proof, root) == nil {
+                t.Fatalf("verify(%d, %d) accepted index %d", index, size, index+1)
+            }
+        }
+    }
+
+    if _, err := tree.InclusionProof(maxTestSize, maxTestSize); err != ErrInvalidIndex {
+        t.Fatalf("proof past the end: error = %v, want %v", err, ErrInvalidIndex)
+    }
+    if _, err := tree.InclusionProof(0, maxTestSize+1); err != ErrInvalidSize {
+        t.Fatalf("proof beyond the tree: error = %v, want %v", err, ErrInvalidSize)
+    }
+    if err := VerifyInclusion(leaves[0], 1, 1, nil, leaves[0]); err != ErrInvalidIndex {
+        t.Fatalf("verify index out of range: error = %v, want %v", err, ErrInvalidIndex)
+    }
+}
+
+func TestConsistencyProofs(t *testing.T) {
+    leaves := testLeaves(maxTestSize)
+    tree := testTree(leaves)
+
+    for second := uint64(0); second <= maxTestSize; second++ {
+        secondRoot := refRoot(leaves[:second])
+        for first := uint64(0); first <= second; first++ {
+            firstRoot := refRoot(leaves[:first])
+            proof, err := tree.ConsistencyProof(first, second)
+            if err != nil {
+                t.Fatalf("proof(%d, %d): %v", first, second, err)
+            }
+            want := [][]byte{}
+            if first > 0 && first < second {
+                want = refSubproof(first, leaves[:second], true)
+            }
+            if !equalProofs(proof, want) {
+                t.Fatalf("proof(%d, %d) differs from the reference", first, second)
+            }
+            if err := VerifyConsistency(first, second, firstRoot, secondRoot, proof); err != nil {
+                t.Fatalf("verify(%d, %d): %v", first, second, err)
+            }
+
+            // The empty tree is a prefix of anything, so only proofs
+            // between non-empty trees carry something to tamper with
+            if first == 0 {
+                continue
+            }
+            if VerifyConsistency(first, second, flipped(firstRoot), secondRoot, proof) == nil {
+                t.Fatalf("verify(%d, %d) accepted a tampered first root", first, second)
+            }
+            if VerifyConsistency(first, second, firstRoot, flipped(secondRoot), proof) == nil {
+                t.Fatalf("verify(%d, %d) accepted a tampered second root", first, second)
+            }
+            for _, p := range tamperedProofs(proof) {
+                if VerifyConsistency(first, second, firstRoot, secondRoot, p) == nil {
+                    t.Fatalf("verify(%d, %d) accepted a tampered proof", first, second)
+                }
+            }
+            if first < second {
+                if second < maxTestSize && VerifyConsistency(first, second+1, firstRoot, refRoot(leaves[:second+1]), proof) == nil {
+                    t.Fatalf("verify(%d, %d) accepted second size %d", first, second, second+1)
+                }
+                if first+1 < second && VerifyConsistency(first+1, second, refRoot(leaves[:first+1]), secondRoot, proof) == nil {
+                    t.Fatalf("verify(%d, %d) accepted first size %d", first, second, first+1)
+                }
+            }
+        }
+    }
+
+    if _, err := tree.ConsistencyProof(2, 1); err != ErrInvalidSize {
+        t.Fatalf("proof of a shrinking tree: error = %v, want %v", err, ErrInvalidSize)
+    }
+    if _, err := tree.ConsistencyProof(1, maxTestSize+1); err != ErrInvalidSize {
+        t.Fatalf("proof beyond the tree: error = %v, want %v", err, ErrInvalidSize)
+    }
+    if err := VerifyConsistency(2, 1, leaves[0], leaves[0], nil); err != ErrInvalidSize {
+        t.Fatalf("verify a shrinking tree: error = %v, want %v", err, ErrInvalidSize)
+    }
+}
+
+func TestVerifyTreeHead(t *testing.T) {
+    signer, err := NewSigner(bytes.Repeat([]byte{7}, ed25519.SeedSize))
+    if err != nil {
+        t.Fatal(err)
+    }
+    root, err := testTree(testLeaves(5)).Root(5)
+    if err != nil {
+        t.Fatal(err)
+    }
+    head := TreeHead{TreeSize: 5, RootHash: root, Timestamp: 1700000000000}
+    signer.Sign(&head)
+    if err := VerifyTreeHead(signer.PublicKey(), &head); err != nil {
+        t.Fatalf("verify: %v", err)
+    }
+
+    tests := []struct {
+        name   string
+        modify func(th *TreeHead)
+    }{
+        {"size", func(th *TreeHead) { th.TreeSize++ }},
+        {"timestamp", func(th *TreeHead) { th.Timestamp++ }},
+        {"root", func(th *TreeHead) { th.RootHash = flipped(th.RootHash) }},
+        {"truncated root", func(th *TreeHead) { th.RootHash = th.RootHash[:len(th.RootHash)-1] }},
+        {"signature", func(th *TreeHead) { th.Signature = flipped(th.Signature) }},
+        {"no signature", func(th *TreeHead) { th.Signature = nil }},
+    }
+    for _, tt := range tests {
+        modified := head
+        tt.modify(&modified)
+        if err := VerifyTreeHead(signer.PublicKey(), &modified); err != ErrInvalidSignature {
+            t.Errorf("modified %s: error = %v, want %v", tt.name, err, ErrInvalidSignature)
+        }
+    }
+
+    other, err := NewSigner(bytes.Repeat([]byte{8}, ed25519.SeedSize))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := VerifyTreeHead(other.PublicKey(), &head); err != ErrInvalidSignature {
+        t.Errorf("other key: error = %v, want %v", err, ErrInvalidSignature)
+    }
+    if _, err := NewSigner(make([]byte, ed25519.SeedSize-1)); err == nil {
+        t.Error("signer accepted a short seed")
+    }
+}
@@ -3,19 +3,203 @@ CREATE TABLE IF NOT EXISTS users (
     username VARCHAR(255) UNIQUE NOT NULL,
     password VARCHAR(255) NOT NULL,
     public_key BYTEA NOT NULL,
+    last_seen_at TIMESTAMP WITH TIME ZONE,
+    presence_visibility VARCHAR(16) NOT NULL DEFAULT 'everyone',
+    message_requests VARCHAR(16) NOT NULL DEFAULT 'everyone',
+    role VARCHAR(16) NOT NULL DEFAULT 'user',
+    delivery_token_hash BYTEA,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE TABLE IF NOT EXISTS conversations (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255),
+    is_group BOOLEAN NOT NULL DEFAULT FALSE,
+    direct_key VARCHAR(64) UNIQUE,
+    last_seq BIGINT NOT NULL DEFAULT 0,
+    message_ttl INTEGER,
+    e2e_required BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS conversation_members (
+    conversation_id INTEGER REFERENCES conversations(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id),
+    role VARCHAR(16) NOT NULL DEFAULT 'member',
+    joined_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (conversation_id, user_id)
+);
+
 CREATE TABLE IF NOT EXISTS messages (
     id SERIAL PRIMARY KEY,
+    conversation_id INTEGER REFERENCES conversations(id),
     sender_id INTEGER REFERENCES users(id),
     receiver_id INTEGER REFERENCES users(id),
+    client_message_id VARCHAR(64),
+    seq BIGINT,
+    type VARCHAR(16) NOT NULL DEFAULT 'chat',
+    reply_to_message_id INTEGER REFERENCES messages(id) ON DELETE SET NULL,
+    thread_root_id INTEGER REFERENCES messages(id) ON DELETE SET NULL,
     content BYTEA NOT NULL,
     timestamp BIGINT NOT NULL,
     read BOOLEAN DEFAULT FALSE,
-    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    version INTEGER NOT NULL DEFAULT 1,
+    edited_at TIMESTAMP WITH TIME ZONE,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (sender_id, client_message_id),
+    UNIQUE (conversation_id, seq)
 );
 
 CREATE INDEX IF NOT EXISTS idx_messages_sender ON messages(sender_id);
 CREATE INDEX IF NOT EXISTS idx_messages_receiver ON messages(receiver_id);
-CREATE INDEX IF NOT EXISTS idx_messages_timestamp ON messages(timestamp);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_messages_timestamp ON messages(timestamp);
+CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages(conversation_id, id);
+CREATE INDEX IF NOT EXISTS idx_messages_thread ON messages(thread_root_id, id);
+CREATE INDEX IF NOT EXISTS idx_messages_expires ON messages(expires_at) WHERE expires_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS message_recipients (
+    message_id INTEGER REFERENCES messages(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id),
+    status VARCHAR(16) NOT NULL DEFAULT 'stored',
+    delivered_at TIMESTAMP WITH TIME ZONE,
+    read_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS message_revisions (
+    message_id INTEGER REFERENCES messages(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    content BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, version)
+);
+
+CREATE TABLE IF NOT EXISTS message_hidden (
+    message_id INTEGER REFERENCES messages(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id),
+    hidden_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS reactions (
+    message_id INTEGER REFERENCES messages(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id),
+    reaction BYTEA NOT NULL,
+    encrypted BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS attachments (
+    id VARCHAR(64) PRIMARY KEY,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS attachment_links (
+    attachment_id VARCHAR(64) REFERENCES attachments(id),
+    conversation_id INTEGER REFERENCES conversations(id) ON DELETE CASCADE,
+    uploaded_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (attachment_id, conversation_id)
+);
+
+CREATE TABLE IF NOT EXISTS attachment_uploads (
+    id VARCHAR(32) PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id),
+    conversation_id INTEGER REFERENCES conversations(id) ON DELETE CASCADE,
+    size BIGINT NOT NULL,
+    attachment_id VARCHAR(64) REFERENCES attachments(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS message_attachments (
+    message_id INTEGER REFERENCES messages(id) ON DELETE CASCADE,
+    attachment_id VARCHAR(64) REFERENCES attachments(id),
+    position INTEGER NOT NULL,
+    PRIMARY KEY (message_id, attachment_id)
+);
+
+CREATE TABLE IF NOT EXISTS scheduled_messages (
+    id SERIAL PRIMARY KEY,
+    sender_id INTEGER REFERENCES users(id),
+    conversation_id INTEGER REFERENCES conversations(id) ON DELETE CASCADE,
+    client_message_id VARCHAR(64),
+    frame JSON NOT NULL,
+    send_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    claimed_at TIMESTAMP WITH TIME ZONE,
+    message_id INTEGER REFERENCES messages(id) ON DELETE SET NULL,
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (sender_id, client_message_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_messages_due ON scheduled_messages(send_at) WHERE status IN ('pending', 'sending');
+
+CREATE TABLE IF NOT EXISTS contact_requests (
+    requester_id INTEGER REFERENCES users(id),
+    addressee_id INTEGER REFERENCES users(id),
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    responded_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (requester_id, addressee_id)
+);
+
+CREATE TABLE IF NOT EXISTS blocks (
+    user_id INTEGER REFERENCES users(id),
+    blocked_id INTEGER REFERENCES users(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, blocked_id)
+);
+
+CREATE TABLE IF NOT EXISTS device_keys (
+    user_id INTEGER REFERENCES users(id),
+    device_id VARCHAR(64) NOT NULL,
+    identity_key BYTEA NOT NULL,
+    signed_prekey_id BIGINT NOT NULL,
+    signed_prekey BYTEA NOT NULL,
+    signed_prekey_signature BYTEA NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, device_id)
+);
+
+CREATE TABLE IF NOT EXISTS one_time_prekeys (
+    user_id INTEGER NOT NULL,
+    device_id VARCHAR(64) NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    key_id BIGINT NOT NULL,
+    public_key BYTEA NOT NULL,
+    signature BYTEA,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, device_id, kind, key_id),
+    FOREIGN KEY (user_id, device_id) REFERENCES device_keys(user_id, device_id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS user_keys (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id),
+    public_key BYTEA NOT NULL,
+    log_index BIGINT,
+    valid_from TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    valid_until TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS key_log (
+    leaf_index BIGINT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    key_type VARCHAR(16) NOT NULL,
+    device_id VARCHAR(64),
+    leaf_data BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversation_members_user ON conversation_members(user_id);
+CREATE INDEX IF NOT EXISTS idx_message_recipients_user ON message_recipients(user_id, status);
+CREATE INDEX IF NOT EXISTS idx_contact_requests_addressee ON contact_requests(addressee_id, status);
+CREATE INDEX IF NOT EXISTS idx_key_log_user ON key_log(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_keys_user ON user_keys(user_id, valid_from);
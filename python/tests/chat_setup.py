@@ -0,0 +1,92 @@
+#!/usr/bin/env python3
+
+# Helpers for the WebSocket tests: the server only accepts chat messages
+# between contacts, and only as well-formed encrypted envelopes
+
+import base64
+import os
+import pathlib
+import subprocess
+import time
+
+import httpx
+
+GO_DIR = pathlib.Path(__file__).resolve().parents[2] / "go"
+
+# Envelope padding bucket and AES-256-GCM sizes, see go/internal/encryption/envelope.go
+PAD_BUCKET = 256
+NONCE_SIZE = 12
+TAG_SIZE = 16
+
+
+def generate_public_key():
+    """Registration only accepts hybrid X25519 + ML-KEM-768 public keys"""
+    result = subprocess.run(
+        ["go", "run", "./cmd/keygen"],
+        cwd=GO_DIR,
+        capture_output=True,
+        text=True,
+        check=True,
+    )
+    return result.stdout.strip()
+
+
+def register_user(base_url, prefix):
+    """Registers a fresh user and returns (user_id, access_token)"""
+    username = f"{prefix}_{int(time.time() * 1000)}"
+    response = httpx.post(
+        f"{base_url}/api/auth/register",
+        json={
+            "username": username,
+            "password": "testpass123",
+            "public_key": generate_public_key(),
+        },
+    )
+    response.raise_for_status()
+    data = response.json()
+    return data["user_id"], data["access_token"]
+
+
+def make_contacts(base_url, requester, addressee):
+    """Sends a contact request from requester and accepts it as addressee.
+    Both are (user_id, access_token) pairs."""
+    requester_id, requester_token = requester
+    addressee_id, addressee_token = addressee
+
+    response = httpx.post(
+        f"{base_url}/api/contacts/requests",
+        headers={"Authorization": f"Bearer {requester_token}"},
+        json={"user_id": addressee_id},
+    )
+    response.raise_for_status()
+
+    response = httpx.post(
+        f"{base_url}/api/contacts/requests/{requester_id}/accept",
+        headers={"Authorization": f"Bearer {addressee_token}"},
+    )
+    response.raise_for_status()
+
+
+def contact_pair(base_url):
+    """Registers two users who are each other's contacts"""
+    sender = register_user(base_url, "ws_sender")
+    receiver = register_user(base_url, "ws_receiver")
+    make_contacts(base_url, sender, receiver)
+    return sender, receiver
+
+
+def envelope():
+    """Returns a well-formed envelope. The server only checks its shape, so
+    random bytes stand in for a real AES-256-GCM ciphertext."""
+
+    def b64(n):
+        return base64.b64encode(os.urandom(n)).decode()
+
+    return {
+        "v": 1,
+        "alg": "aes-256-gcm",
+        "kid": "test-session",
+        "nonce": b64(NONCE_SIZE),
+        "ct": b64(PAD_BUCKET + TAG_SIZE),
+        "pad": PAD_BUCKET,
+    }
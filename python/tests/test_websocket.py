@@ -6,14 +6,18 @@ import json
 import logging
 import sys
 
+from chat_setup import contact_pair, envelope
+
 logging.basicConfig(level=logging.DEBUG)
 
 
-async def test_connection(token):
-    uri = "ws://localhost/ws"
-    headers = {"Authorization": f"Bearer {token}"}
+async def test_connection(base_url):
+    uri = base_url.replace("http", "ws", 1) + "/ws"
 
     try:
+        (_, token), (receiver_id, _) = contact_pair(base_url)
+        headers = {"Authorization": f"Bearer {token}"}
+
         logging.info("Connecting to WebSocket server...")
         websocket = await websockets.connect(
             uri, extra_headers=headers, ping_interval=None, compression=None
@@ -23,8 +27,8 @@ async def test_connection(token):
 
         message = {
             "type": "chat",
-            "content": json.dumps({"text": "Hello!"}),
-            "receiver_id": 1,
+            "content": envelope(),
+            "receiver_id": receiver_id,
         }
 
         logging.info(f"Sending message: {message}")
@@ -42,12 +46,12 @@ async def test_connection(token):
 
 
 if __name__ == "__main__":
-    if len(sys.argv) != 2:
-        print("Usage: python test_websocket.py <token>")
+    if len(sys.argv) > 2:
+        print("Usage: python test_websocket.py [base_url]")
         sys.exit(1)
 
-    token = sys.argv[1]
-    result = asyncio.get_event_loop().run_until_complete(test_connection(token))
+    base_url = sys.argv[1] if len(sys.argv) == 2 else "http://localhost"
+    result = asyncio.get_event_loop().run_until_complete(test_connection(base_url))
 
     if result:
         print("Test completed successfully!")
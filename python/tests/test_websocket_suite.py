@@ -9,6 +9,8 @@ import time
 from datetime import datetime
 import logging
 
+from chat_setup import contact_pair, envelope
+
 logging.basicConfig(
     level=logging.INFO, format="%(asctime)s - %(levelname)s - %(message)s"
 )
@@ -23,9 +25,10 @@ class Colors:
 
 
 class WebSocketTest:
-    def __init__(self, token):
-        self.token = token
-        self.uri = "ws://localhost/ws"
+    def __init__(self, base_url):
+        # Chat messages only go to contacts, so the suite brings its own pair
+        (_, token), (self.receiver_id, _) = contact_pair(base_url)
+        self.uri = base_url.replace("http", "ws", 1) + "/ws"
         self.headers = {
             "Authorization": f"Bearer {token}",
         }
@@ -43,8 +46,8 @@ class WebSocketTest:
 
             message = {
                 "type": "chat",
-                "content": json.dumps({"text": "Connection test"}),
-                "receiver_id": 1,
+                "content": envelope(),
+                "receiver_id": self.receiver_id,
             }
             logging.info(f"Sending test message: {message}")
             await websocket.send(json.dumps(message))
@@ -72,10 +75,9 @@ class WebSocketTest:
 
             message = {
                 "type": "chat",
-                "content": json.dumps(
-                    {"text": "Hello from test suite!", "timestamp": int(time.time())}
-                ),
-                "receiver_id": 1,
+                "content": envelope(),
+                "receiver_id": self.receiver_id,
+                "timestamp": int(time.time()),
             }
 
             logging.info(f"Sending chat message: {message}")
@@ -139,7 +141,12 @@ class WebSocketTest:
 
 def main():
     parser = argparse.ArgumentParser(description="WebSocket Test Suite")
-    parser.add_argument("token", help="JWT access token")
+    parser.add_argument(
+        "base_url",
+        nargs="?",
+        default="http://localhost",
+        help="server address; two contact users are registered there",
+    )
     parser.add_argument("--debug", action="store_true", help="Enable debug logging")
     args = parser.parse_args()
 
@@ -147,7 +154,7 @@ def main():
         logging.getLogger().setLevel(logging.DEBUG)
 
     try:
-        test_suite = WebSocketTest(args.token)
+        test_suite = WebSocketTest(args.base_url)
         asyncio.get_event_loop().run_until_complete(test_suite.run_all_tests())
     except Exception as e:
         print(f"{Colors.RED}Test suite failed: {str(e)}{Colors.RESET}")
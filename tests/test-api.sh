@@ -17,13 +17,21 @@ echo -e "${GREEN}Starting API Tests...${NC}"
 timestamp=$(date +%s)
 TEST_USERNAME="testuser_${timestamp}"
 
+# Registration only accepts hybrid X25519 + ML-KEM-768 public keys
+SCRIPT_DIR="$(cd "$(dirname "$0")" && pwd)"
+PUBLIC_KEY=$(cd "$SCRIPT_DIR/../go" && go run ./cmd/keygen)
+if [ -z "$PUBLIC_KEY" ]; then
+    echo -e "${RED}✗ Could not generate a public key${NC}"
+    exit 1
+fi
+
 echo -e "\n${YELLOW}1. Testing Registration${NC}"
 REGISTER_RESPONSE=$(curl -s -X POST "$BASE_URL/api/auth/register" \
     -H "Content-Type: application/json" \
     -d "{
         \"username\": \"$TEST_USERNAME\",
         \"password\": \"$TEST_PASSWORD\",
-        \"public_key\": \"$(openssl rand -base64 32)\"
+        \"public_key\": \"$PUBLIC_KEY\"
     }")
 
 echo "Registration Response: $REGISTER_RESPONSE"